@@ -0,0 +1,72 @@
+package cmds
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/config"
+)
+
+// profileEnvVar is the environment variable with the profile
+// to be used when the profile option isn't set.
+const profileEnvVar = "WRUN_PROFILE"
+
+// getConfig returns the data from the config file given by the file option,
+// with the profile given by the profile option applied to it. If the root
+// option is set, it overrides the root from the config file.
+func getConfig(cts *cfop.CmdTermsSet) (*config.Config, error) {
+	c, err := config.GetConfig(cts.GetOptString("file"), profileName(cts))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyRootOpt(cts, c); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// applyRootOpt sets c.Root to the value of the root option, if it's set.
+func applyRootOpt(cts *cfop.CmdTermsSet, c *config.Config) error {
+	rootPath := cts.GetOptString("root")
+	if rootPath == "" {
+		return nil
+	}
+
+	rootPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return err
+	}
+
+	if err := config.CheckRoot(rootPath); err != nil {
+		return err
+	}
+
+	c.Root = rootPath
+
+	return nil
+}
+
+// profileName returns the value of the profile option or, if it isn't set,
+// of the WRUN_PROFILE environment variable.
+func profileName(cts *cfop.CmdTermsSet) string {
+	if name := cts.GetOptString("profile"); name != "" {
+		return name
+	}
+
+	return os.Getenv(profileEnvVar)
+}
+
+// applyNoInitialRunFlag makes c's cmds only run after a change
+// happens if the no-initial-run flag is set.
+func applyNoInitialRunFlag(cts *cfop.CmdTermsSet, c *config.Config) {
+	if !cts.GetFlag("no-initial-run") {
+		return
+	}
+
+	for i := range c.Cmds {
+		c.Cmds[i].RunOnStart = false
+	}
+}
@@ -0,0 +1,188 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/pkg/watcher"
+	"golang.org/x/sys/unix"
+)
+
+// fsType is a filesystem type as reported by statfs(2).
+type fsType struct {
+	name string
+	// unreliable is whether inotify may not report changes made
+	// to the filesystem, e.g. by other machines or by the host.
+	unreliable bool
+}
+
+var fsTypes = map[int64]fsType{
+	unix.EXT4_SUPER_MAGIC:      {"ext2/ext3/ext4", false},
+	unix.BTRFS_SUPER_MAGIC:     {"btrfs", false},
+	unix.XFS_SUPER_MAGIC:       {"xfs", false},
+	unix.F2FS_SUPER_MAGIC:      {"f2fs", false},
+	unix.TMPFS_MAGIC:           {"tmpfs", false},
+	0x2fc12fc1:                 {"zfs", false},
+	unix.NFS_SUPER_MAGIC:       {"nfs", true},
+	unix.SMB_SUPER_MAGIC:       {"smb", true},
+	0xff534d42:                 {"cifs", true},
+	0xfe534d42:                 {"smb2", true},
+	unix.V9FS_MAGIC:            {"9p", true},
+	0x65735546:                 {"fuse", true},
+	unix.OVERLAYFS_SUPER_MAGIC: {"overlay", true},
+	0x786f4256:                 {"vboxsf", true},
+}
+
+// Doctor executes the doctor command.
+func Doctor(cts *cfop.CmdTermsSet) {
+	problems := 0
+	warn := func(format string, a ...interface{}) {
+		problems++
+		fmt.Printf("  warning: "+format+"\n", a...)
+	}
+
+	// Config
+	configFilePath, err := config.FindConfigFile(cts.GetOptString("file"))
+	if err != nil {
+		fmt.Println("config file:")
+		warn("%v", err)
+
+		fmt.Printf("\n%v problem(s) found\n", problems)
+
+		return
+	}
+	fmt.Printf("config file: %v\n", configFilePath)
+
+	profile := profileName(cts)
+	if profile != "" {
+		fmt.Printf("profile: %v\n", profile)
+	}
+
+	c, err := config.GetConfig(configFilePath, profile)
+	if err == nil {
+		err = applyRootOpt(cts, c)
+	}
+	if err == nil {
+		err = os.Chdir(c.Root)
+	}
+	if err != nil {
+		warn("%v", err)
+
+		fmt.Printf("\n%v problem(s) found\n", problems)
+
+		return
+	}
+	fmt.Printf("root: %v\n", c.Root)
+
+	fmt.Println("ignore patterns:")
+	for _, rx := range c.IgnoreRegExps {
+		fmt.Printf("  %v\n", rx)
+	}
+
+	// Filesystem
+	var statfs unix.Statfs_t
+	if err := unix.Statfs(".", &statfs); err != nil {
+		fmt.Println("filesystem:")
+		warn("%v", err)
+	} else {
+		name, warning := checkFsType(int64(statfs.Type))
+		fmt.Printf("filesystem: %v\n", name)
+
+		if warning != "" {
+			warn("%v", warning)
+		}
+	}
+
+	// inotify
+	limits, err := watcher.InotifyLimits()
+	fmt.Printf(
+		"inotify limits: max_user_watches=%v max_user_instances=%v max_queued_events=%v\n",
+		limits.MaxUserWatches,
+		limits.MaxUserInstances,
+		limits.MaxQueuedEvents,
+	)
+	if err != nil {
+		warn("%v", err)
+	}
+
+	// the usage and the number of directories are 0 if unknown
+	usage, err := watcher.InotifyUsage()
+	if err != nil {
+		usage = watcher.Usage{}
+		fmt.Println("inotify usage:")
+		warn("%v", err)
+	} else {
+		fmt.Printf("inotify usage: %v watches, %v instances\n", usage.Watches, usage.Instances)
+	}
+
+	nDirs, err := watcher.CountDirs(".", c.IgnoreRegExps)
+	if err != nil {
+		nDirs = 0
+		fmt.Println("watched directories:")
+		warn("%v", err)
+	} else {
+		fmt.Printf("watched directories: %v\n", nDirs)
+	}
+
+	for _, warning := range checkInotifyLimits(limits, usage, nDirs, c.PollFallback) {
+		warn("%v", warning)
+	}
+
+	// Cmds
+	fmt.Println("cmds:")
+	for i, cmdItem := range c.Cmds {
+		cmdPath, err := lookCmdPath(cmdItem)
+		if err != nil {
+			fmt.Printf("  %v: %v\n", cmdLabel(i, cmdItem), cmdItem.Terms[0])
+			warn("%v", err)
+
+			continue
+		}
+
+		fmt.Printf("  %v: %v\n", cmdLabel(i, cmdItem), cmdPath)
+	}
+
+	if problems == 0 {
+		fmt.Println("\nno problems found")
+	} else {
+		fmt.Printf("\n%v problem(s) found\n", problems)
+	}
+}
+
+// checkFsType returns the name of the filesystem type t and, if changes
+// made to it may not be reported by inotify, a warning saying so.
+func checkFsType(t int64) (name, warning string) {
+	ft, ok := fsTypes[t]
+	if !ok {
+		return fmt.Sprintf("unknown (0x%x)", t), ""
+	}
+
+	if ft.unreliable {
+		warning = fmt.Sprintf("changes made to %v filesystems outside of this machine may not be reported by inotify", ft.name)
+	}
+
+	return ft.name, warning
+}
+
+// checkInotifyLimits returns a warning for each inotify limit that has been
+// reached or that would be exceeded by watching nDirs directories.
+// A negative limit is unknown and isn't checked.
+func checkInotifyLimits(limits watcher.Limits, usage watcher.Usage, nDirs int, pollFallback bool) []string {
+	var warnings []string
+
+	if limits.MaxUserInstances >= 0 && usage.Instances >= limits.MaxUserInstances {
+		warnings = append(warnings, "max_user_instances has been reached")
+	}
+
+	if limits.MaxUserWatches >= 0 && usage.Watches+nDirs > limits.MaxUserWatches {
+		if pollFallback {
+			warnings = append(warnings, "max_user_watches would be exceeded, some directories will be polled")
+		} else {
+			warnings = append(warnings, "max_user_watches would be exceeded")
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,176 @@
+package cmds
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/pkg/watcher"
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckFsType(t *testing.T) {
+	tests := []struct {
+		name            string
+		t               int64
+		expectedName    string
+		expectedWarning bool
+	}{
+		{"ext4", unix.EXT4_SUPER_MAGIC, "ext2/ext3/ext4", false},
+		{"nfs", unix.NFS_SUPER_MAGIC, "nfs", true},
+		{"overlay", unix.OVERLAYFS_SUPER_MAGIC, "overlay", true},
+		{"unknown", 0x1234, "unknown (0x1234)", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, warning := checkFsType(test.t)
+
+			if name != test.expectedName {
+				t.Errorf("got %v, want %v", name, test.expectedName)
+			}
+
+			if (warning != "") != test.expectedWarning {
+				t.Errorf("got warning %q, want warning: %v", warning, test.expectedWarning)
+			}
+		})
+	}
+}
+
+func TestCheckInotifyLimits(t *testing.T) {
+	tests := []struct {
+		name             string
+		limits           watcher.Limits
+		usage            watcher.Usage
+		nDirs            int
+		pollFallback     bool
+		expectedWarnings []string
+	}{
+		{
+			"below the limits",
+			watcher.Limits{MaxUserWatches: 100, MaxUserInstances: 10},
+			watcher.Usage{Watches: 50, Instances: 2},
+			50,
+			false,
+			nil,
+		},
+		{
+			"max_user_watches exceeded",
+			watcher.Limits{MaxUserWatches: 100, MaxUserInstances: 10},
+			watcher.Usage{Watches: 50, Instances: 2},
+			51,
+			false,
+			[]string{"max_user_watches would be exceeded"},
+		},
+		{
+			"max_user_watches exceeded with poll fallback",
+			watcher.Limits{MaxUserWatches: 100, MaxUserInstances: 10},
+			watcher.Usage{Watches: 50, Instances: 2},
+			51,
+			true,
+			[]string{"max_user_watches would be exceeded, some directories will be polled"},
+		},
+		{
+			"max_user_instances reached",
+			watcher.Limits{MaxUserWatches: 100, MaxUserInstances: 10},
+			watcher.Usage{Watches: 50, Instances: 10},
+			1,
+			false,
+			[]string{"max_user_instances has been reached"},
+		},
+		{
+			"unknown limits",
+			watcher.Limits{MaxUserWatches: -1, MaxUserInstances: -1},
+			watcher.Usage{Watches: 50, Instances: 10},
+			100,
+			false,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings := checkInotifyLimits(test.limits, test.usage, test.nDirs, test.pollFallback)
+
+			if !reflect.DeepEqual(warnings, test.expectedWarnings) {
+				t.Errorf("got %q, want %q", warnings, test.expectedWarnings)
+			}
+		})
+	}
+}
+
+func TestLookCmdPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrun")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	binDirPath := path.Join(dir, "bin")
+	err = os.Mkdir(binDirPath, os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", binDirPath, err)
+	}
+
+	binPath := path.Join(binDirPath, "foo")
+	err = ioutil.WriteFile(binPath, []byte("#!/bin/sh\n"), 0755)
+	if err != nil {
+		t.Fatalf("unexpected error writing to %v: %v", binPath, err)
+	}
+
+	t.Run("relative to dir", func(t *testing.T) {
+		p, err := lookCmdPath(config.Cmd{Terms: []string{"./bin/foo"}, Dir: dir})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if p != binPath {
+			t.Errorf("got %v, want %v", p, binPath)
+		}
+	})
+
+	t.Run("not relative to the current directory", func(t *testing.T) {
+		_, err := lookCmdPath(config.Cmd{Terms: []string{"./bin/foo"}})
+		if err == nil {
+			t.Error("got nil, want err")
+		}
+	})
+
+	t.Run("cmd PATH", func(t *testing.T) {
+		p, err := lookCmdPath(config.Cmd{Terms: []string{"foo"}, Env: []string{"PATH=" + binDirPath}})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if p != binPath {
+			t.Errorf("got %v, want %v", p, binPath)
+		}
+	})
+
+	t.Run("process PATH", func(t *testing.T) {
+		shPath, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skipf("sh not found: %v", err)
+		}
+
+		p, err := lookCmdPath(config.Cmd{Terms: []string{"sh"}})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if p != shPath {
+			t.Errorf("got %v, want %v", p, shPath)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := lookCmdPath(config.Cmd{Terms: []string{"foo"}, Env: []string{"PATH=" + dir}})
+		if err == nil {
+			t.Error("got nil, want err")
+		}
+	})
+}
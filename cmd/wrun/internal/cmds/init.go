@@ -1,6 +1,8 @@
 package cmds
 
 import (
+	"fmt"
+
 	"github.com/efreitasn/cfop"
 	"github.com/efreitasn/wrun/v4/internal/config"
 	"github.com/efreitasn/wrun/v4/internal/logs"
@@ -8,8 +10,30 @@ import (
 
 // Init executes the init command.
 func Init(cts *cfop.CmdTermsSet) {
-	err := config.CreateConfigFile()
+	templateName := cts.GetOptString("template")
+	if templateName == "" {
+		templateName = config.DetectTemplate()
+
+		if templateName != "" {
+			fmt.Printf("using the %v template\n", templateName)
+		}
+	}
+
+	err := config.CreateConfigFile(templateName)
 	if err != nil {
 		logs.Err.Println(err)
+
+		return
+	}
+
+	added, err := config.GitIgnoreLocalConfigFiles(".")
+	if err != nil {
+		logs.Err.Printf("adding the local config files to .gitignore: %v\n", err)
+
+		return
+	}
+
+	if added {
+		fmt.Println("added wrun.local.* to .gitignore")
 	}
 }
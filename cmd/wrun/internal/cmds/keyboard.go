@@ -0,0 +1,163 @@
+package cmds
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// keyboard reads the keys pressed in the terminal attached to stdin,
+// which is put in cbreak mode so that keys are read as soon as they're
+// pressed, without being echoed.
+type keyboard struct {
+	fd       int
+	oldState unix.Termios
+	keys     chan byte
+	// done is closed when the terminal is restored.
+	done chan struct{}
+}
+
+// stdinIsTerminal returns whether stdin is a terminal.
+func stdinIsTerminal() bool {
+	_, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), unix.TCGETS)
+
+	return err == nil
+}
+
+// newKeyboard puts the terminal attached to stdin in cbreak mode and starts
+// reading keys from it. If stdin isn't a terminal or wrun isn't in the
+// terminal's foreground process group, it returns nil.
+func newKeyboard() (*keyboard, error) {
+	fd := int(os.Stdin.Fd())
+
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		// not a terminal
+		return nil, nil
+	}
+
+	// changing the mode of the terminal from
+	// the background would stop wrun
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || pgrp != unix.Getpgrp() {
+		return nil, nil
+	}
+
+	oldState := *termios
+
+	// ISIG is kept, so that ctrl+c still sends a SIGINT
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return nil, err
+	}
+
+	kb := &keyboard{
+		fd:       fd,
+		oldState: oldState,
+		keys:     make(chan byte),
+		done:     make(chan struct{}),
+	}
+
+	go kb.read()
+
+	return kb, nil
+}
+
+// Keys returns the channel of the keys pressed.
+func (kb *keyboard) Keys() <-chan byte {
+	return kb.keys
+}
+
+// Restore restores the terminal to the mode it was in before newKeyboard
+// and stops sending the keys pressed. It must only be called once.
+func (kb *keyboard) Restore() error {
+	close(kb.done)
+
+	return unix.IoctlSetTermios(kb.fd, unix.TCSETS, &kb.oldState)
+}
+
+func (kb *keyboard) read() {
+	bs := make([]byte, 64)
+
+	for {
+		n, err := os.Stdin.Read(bs)
+		if err != nil {
+			return
+		}
+
+		for _, b := range bs[:n] {
+			// nothing receives the keys once the terminal is restored
+			select {
+			case kb.keys <- b:
+			case <-kb.done:
+				return
+			}
+		}
+	}
+}
+
+// keyAction is what happens when a key is pressed.
+type keyAction int
+
+// Key actions.
+const (
+	keyActionNone keyAction = iota
+	keyActionRerun
+	keyActionPause
+	keyActionClear
+	keyActionQuit
+)
+
+// parseKey returns the action of key given the number of cmds. If the action
+// is keyActionRerun, only is the 1-based position of the only cmd to rerun,
+// or 0 if all of them are rerun.
+func parseKey(key byte, nCmds int) (action keyAction, only int) {
+	switch {
+	case key == 'r':
+		return keyActionRerun, 0
+	case key >= '1' && key <= '9' && int(key-'0') <= nCmds:
+		return keyActionRerun, int(key - '0')
+	case key == 'p':
+		return keyActionPause, 0
+	case key == 'c':
+		return keyActionClear, 0
+	case key == 'q':
+		return keyActionQuit, 0
+	default:
+		return keyActionNone, 0
+	}
+}
+
+// pauseState is whether events are ignored, which
+// is the case while watching is paused.
+type pauseState struct {
+	paused bool
+	// missed is whether any event was ignored since watching was paused.
+	missed bool
+}
+
+// toggle pauses or resumes watching and returns whether the cmds must be
+// rerun, which is the case when resuming after any event was ignored.
+func (ps *pauseState) toggle() (rerun bool) {
+	ps.paused = !ps.paused
+
+	if ps.paused {
+		return false
+	}
+
+	rerun, ps.missed = ps.missed, false
+
+	return rerun
+}
+
+// ignore returns whether an event is ignored, recording it if it is.
+func (ps *pauseState) ignore() bool {
+	if ps.paused {
+		ps.missed = true
+	}
+
+	return ps.paused
+}
@@ -0,0 +1,76 @@
+package cmds
+
+import (
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		key            byte
+		expectedAction keyAction
+		expectedOnly   int
+	}{
+		{'r', keyActionRerun, 0},
+		{'1', keyActionRerun, 1},
+		{'3', keyActionRerun, 3},
+		// there are only 3 cmds
+		{'4', keyActionNone, 0},
+		{'0', keyActionNone, 0},
+		{'p', keyActionPause, 0},
+		{'c', keyActionClear, 0},
+		{'q', keyActionQuit, 0},
+		{'x', keyActionNone, 0},
+		{'R', keyActionNone, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.key), func(t *testing.T) {
+			action, only := parseKey(test.key, 3)
+
+			if action != test.expectedAction {
+				t.Errorf("got %v, want %v", action, test.expectedAction)
+			}
+
+			if only != test.expectedOnly {
+				t.Errorf("got %v, want %v", only, test.expectedOnly)
+			}
+		})
+	}
+}
+
+func TestPauseState(t *testing.T) {
+	var ps pauseState
+
+	if ps.ignore() {
+		t.Error("event ignored before pausing")
+	}
+
+	if ps.toggle() || !ps.paused {
+		t.Fatal("not paused")
+	}
+
+	// resuming without ignored events
+	if rerun := ps.toggle(); rerun || ps.paused {
+		t.Errorf("got (%v, %v), want (false, false)", rerun, ps.paused)
+	}
+
+	ps.toggle()
+
+	if !ps.ignore() || !ps.ignore() {
+		t.Error("event not ignored while paused")
+	}
+
+	if rerun := ps.toggle(); !rerun || ps.paused {
+		t.Errorf("got (%v, %v), want (true, false)", rerun, ps.paused)
+	}
+
+	if ps.ignore() {
+		t.Error("event ignored after resuming")
+	}
+
+	// the ignored events were already taken into account
+	ps.toggle()
+	if rerun := ps.toggle(); rerun {
+		t.Errorf("got %v, want %v", rerun, false)
+	}
+}
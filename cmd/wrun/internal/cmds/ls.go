@@ -0,0 +1,154 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/logs"
+	"github.com/efreitasn/wrun/v4/pkg/watcher"
+)
+
+// lsItem is a file or directory printed by the ls command.
+type lsItem struct {
+	Path  string `json:"path"`
+	IsDir bool   `json:"isDir"`
+	// IgnoredBy is the regexp that matched the item, if it's ignored.
+	IgnoredBy string    `json:"ignoredBy,omitempty"`
+	Children  []*lsItem `json:"children,omitempty"`
+}
+
+type lsJSON struct {
+	Dirs    int     `json:"dirs"`
+	Files   int     `json:"files"`
+	Ignored int     `json:"ignored"`
+	Tree    *lsItem `json:"tree"`
+}
+
+// Ls executes the ls command.
+func Ls(cts *cfop.CmdTermsSet) {
+	// Config
+	c, err := getConfig(cts)
+	if err != nil {
+		logs.Err.Printf("config file: %v\n", err)
+
+		return
+	}
+
+	if err := os.Chdir(c.Root); err != nil {
+		logs.Err.Println(err)
+
+		return
+	}
+
+	d, err := watcher.Scan(".", c.IgnoreRegExps)
+	if err != nil {
+		logs.Err.Println(err)
+
+		return
+	}
+
+	root := newLsItem(d)
+	dirs, files, ignored := d.Count()
+
+	switch {
+	case cts.GetFlag("json"):
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(lsJSON{
+			Dirs:    dirs,
+			Files:   files,
+			Ignored: ignored,
+			Tree:    root,
+		}); err != nil {
+			logs.Err.Println(err)
+		}
+
+		return
+	case cts.GetFlag("flat"):
+		for _, child := range root.Children {
+			printLsFlat(child)
+		}
+	default:
+		fmt.Println(root.Path)
+		printLsTree(root, "")
+	}
+
+	fmt.Printf("\n%v directories and %v files watched, %v items ignored\n", dirs, files, ignored)
+}
+
+// newLsItem returns the lsItem for d, with the children sorted by name.
+func newLsItem(d *watcher.Dir) *lsItem {
+	item := &lsItem{
+		Path:  d.Path,
+		IsDir: true,
+	}
+
+	for _, child := range d.Dirs {
+		item.Children = append(item.Children, newLsItem(child))
+	}
+
+	for _, filePath := range d.Files {
+		item.Children = append(item.Children, &lsItem{Path: filePath})
+	}
+
+	for _, ignoredItem := range d.Ignored {
+		item.Children = append(item.Children, &lsItem{
+			Path:      ignoredItem.Path,
+			IsDir:     ignoredItem.IsDir,
+			IgnoredBy: ignoredItem.RegExp.String(),
+		})
+	}
+
+	sort.Slice(item.Children, func(i, j int) bool {
+		return item.Children[i].Path < item.Children[j].Path
+	})
+
+	return item
+}
+
+func (item *lsItem) String() string {
+	name := path.Base(item.Path)
+	if item.IsDir {
+		name += "/"
+	}
+
+	if item.IgnoredBy != "" {
+		return fmt.Sprintf("%v (ignored by %v)", name, item.IgnoredBy)
+	}
+
+	return name
+}
+
+func printLsTree(item *lsItem, prefix string) {
+	for i, child := range item.Children {
+		if i == len(item.Children)-1 {
+			fmt.Printf("%v└── %v\n", prefix, child)
+			printLsTree(child, prefix+"    ")
+		} else {
+			fmt.Printf("%v├── %v\n", prefix, child)
+			printLsTree(child, prefix+"│   ")
+		}
+	}
+}
+
+func printLsFlat(item *lsItem) {
+	p := item.Path
+	if item.IsDir {
+		p += "/"
+	}
+
+	if item.IgnoredBy != "" {
+		fmt.Printf("%v (ignored by %v)\n", p, item.IgnoredBy)
+	} else {
+		fmt.Println(p)
+	}
+
+	for _, child := range item.Children {
+		printLsFlat(child)
+	}
+}
@@ -0,0 +1,52 @@
+package cmds
+
+import (
+	"strconv"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/internal/glob"
+	"github.com/efreitasn/wrun/v4/internal/logs"
+)
+
+// Run executes the run command, which runs terms without a config file.
+func Run(cts *cfop.CmdTermsSet, terms []string) {
+	// Flags
+	shouldLog := !cts.GetFlag("quiet")
+	shouldLogEvents := shouldLog && !cts.GetFlag("no-events")
+
+	if len(terms) == 0 {
+		logs.Err.Println("missing command, e.g. wrun run -- go test ./...")
+
+		return
+	}
+
+	opts := config.AdHocOptions{
+		Terms:      terms,
+		Include:    glob.SplitList(cts.GetOptString("include")),
+		Ignore:     glob.SplitList(cts.GetOptString("ignore")),
+		KillSignal: cts.GetOptString("signal"),
+	}
+
+	if delayStr := cts.GetOptString("delay"); delayStr != "" {
+		delay, err := strconv.Atoi(delayStr)
+		if err != nil {
+			logs.Err.Printf("%v delay is invalid\n", delayStr)
+
+			return
+		}
+
+		opts.DelayToKill = &delay
+	}
+
+	c, err := config.NewAdHocConfig(opts)
+	if err != nil {
+		logs.Err.Println(err)
+
+		return
+	}
+
+	applyNoInitialRunFlag(cts, c)
+
+	start(c, shouldLog, shouldLogEvents)
+}
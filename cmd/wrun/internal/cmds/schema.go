@@ -0,0 +1,16 @@
+package cmds
+
+import (
+	"os"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/internal/logs"
+)
+
+// Schema executes the schema command.
+func Schema(cts *cfop.CmdTermsSet) {
+	if _, err := os.Stdout.Write(config.Schema()); err != nil {
+		logs.Err.Println(err)
+	}
+}
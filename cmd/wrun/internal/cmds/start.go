@@ -2,20 +2,34 @@ package cmds
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/efreitasn/cfop"
 	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/internal/fingerprint"
 	"github.com/efreitasn/wrun/v4/internal/logs"
 	"github.com/efreitasn/wrun/v4/pkg/watcher"
 )
 
+// cacheDirPath is the path of the directory where the fingerprints
+// of the inputs of cmds are stored.
+const cacheDirPath = ".wrun/cache"
+
+// snapshotPath is the path of the file where the state of the
+// watched directory is stored when wrun exits.
+const snapshotPath = ".wrun/snapshot.json"
+
 // Start executes the start command.
 func Start(cts *cfop.CmdTermsSet) {
 	// Flags
@@ -23,7 +37,7 @@ func Start(cts *cfop.CmdTermsSet) {
 	shouldLogEvents := shouldLog && !cts.GetFlag("no-events")
 
 	// Config
-	c, err := config.GetConfig(cts.GetOptString("file"))
+	c, err := getConfig(cts)
 
 	if err != nil {
 		logs.Err.Printf("config file: %v\n", err)
@@ -31,17 +45,150 @@ func Start(cts *cfop.CmdTermsSet) {
 		return
 	}
 
+	if tasks := cts.GetOptString("task"); tasks != "" {
+		if err := c.SelectCmds(strings.Split(tasks, ",")); err != nil {
+			logs.Err.Println(err)
+
+			return
+		}
+	}
+
+	applyNoInitialRunFlag(cts, c)
+
+	start(c, shouldLog, shouldLogEvents)
+}
+
+// start watches c.Root and runs c's cmds
+// at startup and whenever an event is received.
+func start(c *config.Config, shouldLog, shouldLogEvents bool) {
+	if err := os.Chdir(c.Root); err != nil {
+		logs.Err.Println(err)
+
+		return
+	}
+
 	// Signals
 	deadlySignals := make(chan os.Signal, 1)
 	signal.Notify(deadlySignals, os.Interrupt, syscall.SIGTERM)
 
 	// Watcher
-	w, err := watcher.New(".", c.IgnoreRegExps)
+	watcherOpts := watcher.Options{
+		SkipUnchangedWrites:  c.SkipUnchangedWrites,
+		HashSizeLimit:        c.HashSizeLimit,
+		RenameWindow:         time.Duration(int(time.Millisecond) * c.RenameWindow),
+		SplitUnpairedRenames: c.SplitRenames,
+		PollFallback:         c.PollFallback,
+		PollInterval:         time.Duration(int(time.Millisecond) * c.PollInterval),
+	}
+	if c.Snapshot {
+		watcherOpts.SnapshotPath = snapshotPath
+	}
+
+	w, err := watcher.NewWithOptions(".", c.IgnoreRegExps, watcherOpts)
 	if err != nil {
 		logs.Err.Printf("watcher: %v\n", err)
 
 		return
 	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			logs.Err.Printf("watcher: %v\n", err)
+		}
+	}()
+
+	if polled := w.Polled(); len(polled) > 0 && shouldLog {
+		logs.Err.Printf(
+			"watcher: inotify watch limit reached, polling %v directories every %vms\n",
+			len(polled),
+			c.PollInterval,
+		)
+	}
+
+	cache := fingerprint.NewCache(cacheDirPath)
+
+	// Keyboard
+	var keys <-chan byte
+
+	if kb := openKeyboard(c.Cmds, newKeyboard, shouldLog, shouldLogEvents); kb != nil {
+		defer func() {
+			if err := kb.Restore(); err != nil {
+				logs.Err.Printf("keyboard: %v\n", err)
+			}
+		}()
+
+		keys = kb.Keys()
+
+		if shouldLogEvents {
+			logs.Evt.Println("keys: r rerun, 1-9 rerun a cmd, p pause/resume, c clear, q quit")
+		}
+	}
+
+	// the changes made while wrun wasn't running are received at once, so
+	// that each one of them doesn't restart the first run
+	pending := make([]watcher.Event, 0, w.Pending())
+	for len(pending) < w.Pending() {
+		select {
+		case e := <-w.Events():
+			pending = append(pending, e)
+		case err := <-w.Errs():
+			logs.Err.Printf("watcher: %v\n", err)
+
+			return
+		case <-deadlySignals:
+			return
+		}
+	}
+
+	loop(c, cache, loopInputs{
+		pending: pending,
+		events:  w.Events(),
+		errs:    w.Errs(),
+		keys:    keys,
+		quit:    deadlySignals,
+	}, shouldLog, shouldLogEvents)
+}
+
+// loopInputs are the channels loop receives from.
+type loopInputs struct {
+	// pending are the events received before the first run,
+	// which is run once for all of them.
+	pending []watcher.Event
+	events  <-chan watcher.Event
+	errs    <-chan error
+	// keys is nil if there's no keyboard.
+	keys <-chan byte
+	// quit receives the signals that stop wrun.
+	quit <-chan os.Signal
+}
+
+// loop runs c's cmds at startup and whenever an event is received from in,
+// until a quit signal or a watcher error is received or q is pressed.
+func loop(c *config.Config, cache *fingerprint.Cache, in loopInputs, shouldLog, shouldLogEvents bool) {
+	var ps pauseState
+
+	t := trigger{
+		startup:    true,
+		allChanged: true,
+	}
+
+	// if there are pending events, the first run is
+	// the same as if they had happened after startup
+	for _, e := range in.pending {
+		if !isIncluded(c.IncludeRegExps, e) {
+			continue
+		}
+
+		if shouldLogEvents {
+			logs.Evt.Println(e)
+		}
+
+		t.startup = false
+		t.changedPaths = append(t.changedPaths, eventPaths(e)...)
+	}
+
+	if shouldLogEvents && t.startup && !anyRunsOnStart(c.Cmds) {
+		logs.Evt.Println("waiting for changes")
+	}
 
 	for {
 		// allCmdsForCurrentEvtCtx is used to indicate that all cmds related to the current event
@@ -50,90 +197,581 @@ func Start(cts *cfop.CmdTermsSet) {
 		// allCmdsForCurrentEvtDone indicates that all cmds related to the current event have completed
 		// or been terminated.
 		allCmdsForCurrentEvtDone := make(chan struct{})
+		// runCompleted is whether the cmds related to the current event have completed without
+		// being terminated. It must only be read after allCmdsForCurrentEvtDone is closed.
+		var runCompleted bool
+		rs := newRunState()
 
-		go func() {
-			for i, cmdItem := range c.Cmds {
-				if shouldLogEvents {
-					logs.Evt.Printf("starting cmds[%v]\n", i)
+		go func(t trigger) {
+			runCompleted = runCmds(allCmdsForCurrentEvtCtx, c, cache, t, rs, shouldLog, shouldLogEvents)
+
+			close(allCmdsForCurrentEvtDone)
+		}(t)
+
+		// queuedPaths are the paths changed since the cmds started.
+		var queuedPaths []string
+		// rerun is set when the cmds are rerun from the keyboard.
+		var rerun *trigger
+
+	waitForEvent:
+		for {
+			// only ready if the cmds must run again once they stop
+			var queuedRunReady <-chan struct{}
+			if rs.isQueued() {
+				queuedRunReady = allCmdsForCurrentEvtDone
+			}
+
+			select {
+			case <-in.quit:
+				select {
+				case <-allCmdsForCurrentEvtDone:
+					// not really necessary
+					cancelAllCmdsForCurrentEvtCtx()
+				default:
+					cancelAllCmdsForCurrentEvtCtx()
+					<-allCmdsForCurrentEvtDone
 				}
-				err := runCmd(allCmdsForCurrentEvtCtx, cmdItem, shouldLog)
 
-				if err != nil {
-					if shouldLog {
-						logs.Err.Printf("cmds[%v]: %v\n", i, err)
-					}
+				return
+			case err := <-in.errs:
+				logs.Err.Printf("watcher: %v\n", err)
 
-					if cmdItem.FatalIfErr {
-						if shouldLogEvents {
-							logs.Evt.Println("the remaining cmds will be skipped due to the fatalIfErr flag")
+				cancelAllCmdsForCurrentEvtCtx()
+				<-allCmdsForCurrentEvtDone
+
+				return
+			case <-queuedRunReady:
+				break waitForEvent
+			case key := <-in.keys:
+				action, only := parseKey(key, len(c.Cmds))
+
+				switch action {
+				case keyActionQuit:
+					cancelAllCmdsForCurrentEvtCtx()
+					<-allCmdsForCurrentEvtDone
+
+					return
+				case keyActionClear:
+					fmt.Print("\033[H\033[2J")
+				case keyActionPause:
+					resumedRerun := ps.toggle()
+
+					if shouldLogEvents {
+						switch {
+						case ps.paused:
+							logs.Evt.Println("paused, changes will be ignored")
+						case resumedRerun:
+							logs.Evt.Println("resumed, rerunning since there were changes while paused")
+						default:
+							logs.Evt.Println("resumed")
 						}
+					}
 
-						break
+					if resumedRerun {
+						rerun = &trigger{forced: true}
 					}
+				case keyActionRerun:
+					rerun = &trigger{forced: true, only: only}
+				}
 
+				if rerun == nil {
 					continue
 				}
-			}
 
-			close(allCmdsForCurrentEvtDone)
-		}()
-
-		select {
-		case <-deadlySignals:
-			select {
-			case <-allCmdsForCurrentEvtDone:
-				// not really necessary
 				cancelAllCmdsForCurrentEvtCtx()
-			default:
+				<-allCmdsForCurrentEvtDone
+
+				break waitForEvent
+			case e := <-in.events:
+				if !isIncluded(c.IncludeRegExps, e) || ps.ignore() {
+					continue
+				}
+
+				if shouldLogEvents {
+					logs.Evt.Println(e)
+				}
+
+				select {
+				case <-allCmdsForCurrentEvtDone:
+				default:
+					rc := rs.runningCmd()
+
+					switch rc.onChange {
+					case config.OnChangeIgnore:
+						if shouldLogEvents {
+							logs.Evt.Printf("ignored, %v is running\n", rc.label)
+						}
+
+						continue
+					case config.OnChangeQueue:
+						if shouldLogEvents && !rs.isQueued() {
+							logs.Evt.Printf("queued, %v won't be interrupted\n", rc.label)
+						}
+
+						rs.queue()
+						queuedPaths = append(queuedPaths, eventPaths(e)...)
+
+						continue
+					}
+				}
+
 				cancelAllCmdsForCurrentEvtCtx()
 				<-allCmdsForCurrentEvtDone
+
+				queuedPaths = append(queuedPaths, eventPaths(e)...)
+
+				break waitForEvent
 			}
+		}
 
-			return
-		case err := <-w.Errs():
-			logs.Err.Printf("watcher: %v\n", err)
+		cancelAllCmdsForCurrentEvtCtx()
 
-			cancelAllCmdsForCurrentEvtCtx()
-			<-allCmdsForCurrentEvtDone
+		// the changes that triggered an interrupted run are carried over
+		// to the next one, as well as the ones not seen by all the cmds
+		// due to a run of a single cmd
+		if runCompleted && t.only == 0 {
+			t = trigger{}
+		}
+		t.startup = false
+		t.forced = false
+		t.only = 0
+		t.changedPaths = append(t.changedPaths, queuedPaths...)
+
+		if rerun != nil {
+			rerun.allChanged = t.allChanged
+			rerun.changedPaths = t.changedPaths
+			t = *rerun
+		}
+	}
+}
 
-			return
-		case e := <-w.Events():
+// runState is the state of a run of the cmds shared between
+// the goroutine running them and the one receiving events.
+type runState struct {
+	// running holds the runningCmd with the cmd being run.
+	running atomic.Value
+	// queued is 1 if the cmds must run again once the cmds that
+	// can't be interrupted complete.
+	queued int32
+}
+
+// runningCmd is the cmd being run.
+type runningCmd struct {
+	label    string
+	onChange config.OnChange
+}
+
+func newRunState() *runState {
+	rs := &runState{}
+	rs.running.Store(runningCmd{})
+
+	return rs
+}
+
+func (rs *runState) setRunningCmd(rc runningCmd) {
+	rs.running.Store(rc)
+}
+
+func (rs *runState) runningCmd() runningCmd {
+	return rs.running.Load().(runningCmd)
+}
+
+func (rs *runState) queue() {
+	atomic.StoreInt32(&rs.queued, 1)
+}
+
+func (rs *runState) isQueued() bool {
+	return atomic.LoadInt32(&rs.queued) == 1
+}
+
+// trigger describes what triggered a run of the cmds.
+type trigger struct {
+	// startup is whether the run happens at startup, before any event.
+	startup bool
+	// allChanged is whether every path is considered changed,
+	// which is the case until a run is completed.
+	allChanged bool
+	// changedPaths are the paths changed since the last completed run.
+	changedPaths []string
+	// forced is whether the run was requested from the keyboard, in which
+	// case the when.changed conditions and the inputs are disregarded.
+	forced bool
+	// only is the 1-based position of the only cmd to run, which also
+	// disregards its when.status, or 0 if all of them run.
+	only int
+}
+
+// runCmds runs c's cmds in order until ctx is done and returns whether all of
+// them were run, i.e. ctx wasn't done before they ended. t is used for the
+// runOnStart and when.changed conditions and to select the cmds to run. The cmd being run is stored in rs
+// and, if a run is queued in rs, the cmds stop before the next cmd that can
+// be interrupted.
+func runCmds(ctx context.Context, c *config.Config, cache *fingerprint.Cache, t trigger, rs *runState, shouldLog, shouldLogEvents bool) bool {
+	// failed is whether any of the cmds failed, and skipping is whether
+	// the remaining cmds are skipped due to fatalIfErr.
+	var failed, skipping bool
+
+	for i, cmdItem := range c.Cmds {
+		if ctx.Err() != nil || (rs.isQueued() && cmdItem.OnChange == config.OnChangeRestart) {
+			return false
+		}
+
+		if t.startup && !cmdItem.RunOnStart {
+			continue
+		}
+
+		if t.only != 0 && i+1 != t.only {
+			continue
+		}
+
+		label := cmdLabel(i, cmdItem)
+
+		// set before the checks below, which can take a while, so
+		// that the cmd's onChange applies to the events received
+		rs.setRunningCmd(runningCmd{label, cmdItem.OnChange})
+
+		if t.only == 0 && !meetsStatus(cmdItem.When.Status, failed, skipping) {
+			if shouldLogEvents && cmdItem.When.Status != config.StatusDefault {
+				logs.Evt.Printf("skipping %v, its when.status is %v\n", label, cmdItem.When.Status)
+			}
+
+			continue
+		}
+
+		if !t.forced && !t.allChanged && cmdItem.When.Changed != nil && !matchesAny(cmdItem.When.Changed, t.changedPaths) {
 			if shouldLogEvents {
-				logs.Evt.Println(e)
+				logs.Evt.Printf("skipping %v, no changed path matches its when.changed\n", label)
+			}
+
+			continue
+		}
+
+		var fp string
+
+		if cmdItem.Inputs != nil {
+			var upToDate bool
+			var err error
+
+			fp, upToDate, err = checkFingerprint(cache, cmdItem, c.IgnoreRegExps)
+			if err != nil && shouldLog {
+				logs.Err.Printf("%v: fingerprint: %v\n", label, err)
+			}
+
+			if upToDate && !t.forced {
+				if shouldLogEvents {
+					logs.Evt.Printf("%v is up to date\n", label)
+				}
+
+				continue
+			}
+		}
+
+		err := runCmdWithRetries(ctx, cmdItem, label, shouldLog, shouldLogEvents)
+
+		if err != nil {
+			failed = true
+
+			if cmdItem.FatalIfErr && !skipping {
+				if shouldLogEvents {
+					logs.Evt.Println("the remaining cmds will be skipped due to the fatalIfErr flag")
+				}
+
+				skipping = true
+			}
+
+			continue
+		}
+
+		// a cmd stopped by ctx may exit successfully without having finished
+		if fp != "" && ctx.Err() == nil {
+			if err := cache.Set(cacheKey(cmdItem), fp); err != nil && shouldLog {
+				logs.Err.Printf("%v: fingerprint: %v\n", label, err)
 			}
+		}
+	}
+
+	return ctx.Err() == nil
+}
+
+// anyRunsOnStart returns whether any of cmds runs at startup.
+func anyRunsOnStart(cmds []config.Cmd) bool {
+	for _, cmd := range cmds {
+		if cmd.RunOnStart {
+			return true
+		}
+	}
+
+	return false
+}
 
-			cancelAllCmdsForCurrentEvtCtx()
-			<-allCmdsForCurrentEvtDone
+// openKeyboard returns the keyboard created by newKb, or nil if there's none.
+// If any of cmds reads stdin, the keys pressed would be read by it, so
+// newKb isn't called and nil is returned.
+func openKeyboard(cmds []config.Cmd, newKb func() (*keyboard, error), shouldLog, shouldLogEvents bool) *keyboard {
+	if i := stdinCmdIndex(cmds); i != -1 {
+		if shouldLogEvents && stdinIsTerminal() {
+			logs.Evt.Printf("keyboard controls are disabled, %v reads stdin\n", cmdLabel(i, cmds[i]))
 		}
+
+		return nil
 	}
+
+	kb, err := newKb()
+	if err != nil && shouldLog {
+		logs.Err.Printf("keyboard: %v\n", err)
+	}
+
+	return kb
 }
 
-// runCmd runs the given cmd.
+// stdinCmdIndex returns the index of the first of cmds
+// that reads stdin, or -1 if there's none.
+func stdinCmdIndex(cmds []config.Cmd) int {
+	for i, cmd := range cmds {
+		if cmd.Stdin {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// meetsStatus returns whether a cmd with the given when.status runs, given
+// whether any of the previous cmds failed and whether the remaining cmds are
+// skipped due to fatalIfErr.
+func meetsStatus(status config.Status, failed, skipping bool) bool {
+	switch status {
+	case config.StatusOnSuccess:
+		return !failed
+	case config.StatusOnFailure:
+		return failed
+	case config.StatusAlways:
+		return true
+	default:
+		return !skipping
+	}
+}
+
+// matchesAny returns whether any of paths matches any of rxs.
+func matchesAny(rxs []*regexp.Regexp, paths []string) bool {
+	for _, p := range paths {
+		for _, rx := range rxs {
+			if rx.MatchString(p) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// eventPaths returns the path of e and, if e is a RenameEvent, its old path.
+// Paths from unwatched directories, which are empty, are left out.
+func eventPaths(e watcher.Event) []string {
+	var paths []string
+	if e.Path() != "" {
+		paths = append(paths, e.Path())
+	}
+
+	if re, ok := e.(watcher.RenameEvent); ok && re.OldPath != "" {
+		paths = append(paths, re.OldPath)
+	}
+
+	return paths
+}
+
+// cmdLabel returns the name of cmd, the i-th cmd of the config,
+// or cmds[i] if it doesn't have one.
+func cmdLabel(i int, cmd config.Cmd) string {
+	if cmd.Name != "" {
+		return cmd.Name
+	}
+
+	return fmt.Sprintf("cmds[%v]", i)
+}
+
+// lookCmdPath returns the absolute path of the executable run by cmd. If its
+// first term contains a slash, it's relative to cmd.Dir. Otherwise, it's
+// looked up in the PATH set in cmd.Env or, if none is set, in the PATH of
+// the current process.
+func lookCmdPath(cmd config.Cmd) (string, error) {
+	name := cmd.Terms[0]
+
+	if strings.Contains(name, "/") {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(cmd.Dir, name)
+		}
+
+		if _, err := exec.LookPath(name); err != nil {
+			return "", err
+		}
+
+		return filepath.Abs(name)
+	}
+
+	pathEnv := os.Getenv("PATH")
+	for _, envVar := range cmd.Env {
+		if strings.HasPrefix(envVar, "PATH=") {
+			pathEnv = strings.TrimPrefix(envVar, "PATH=")
+		}
+	}
+
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			dir = "."
+		}
+
+		// not joined with filepath.Join, which would turn ./name into name,
+		// so that the path contains a slash and isn't looked up in PATH
+		p := dir + "/" + name
+		if _, err := exec.LookPath(p); err == nil {
+			return filepath.Abs(p)
+		}
+	}
+
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// isIncluded returns whether the path of e, or its old path if e is a RenameEvent,
+// matches at least one of includeRegExps. If includeRegExps is nil, it returns true.
+func isIncluded(includeRegExps []*regexp.Regexp, e watcher.Event) bool {
+	if includeRegExps == nil {
+		return true
+	}
+
+	return matchesAny(includeRegExps, eventPaths(e))
+}
+
+// cacheKey returns the key of the fingerprint of cmd in the cache. Besides its
+// terms, it depends on its dir, env and inputs, so that cmds with the same terms
+// don't share the same fingerprint.
+func cacheKey(cmd config.Cmd) string {
+	inputs := make([]string, len(cmd.Inputs))
+	for i, rx := range cmd.Inputs {
+		inputs[i] = rx.String()
+	}
+
+	return fingerprint.Key(cmd.Terms, []string{cmd.Dir}, cmd.Env, inputs)
+}
+
+// checkFingerprint computes the fingerprint of cmd's inputs and returns it along with
+// whether it's equal to the one stored for the last successful run of cmd and all of
+// cmd's outputs exist.
+func checkFingerprint(cache *fingerprint.Cache, cmd config.Cmd, ignoreRegExps []*regexp.Regexp) (fp string, upToDate bool, err error) {
+	fp, err = fingerprint.Compute(cmd.Inputs, ignoreRegExps, cmd.Terms...)
+	if err != nil {
+		return "", false, err
+	}
+
+	lastFp, err := cache.Get(cacheKey(cmd))
+	if err != nil {
+		return fp, false, err
+	}
+
+	if lastFp != fp {
+		return fp, false, nil
+	}
+
+	if cmd.Outputs != nil {
+		exist, err := fingerprint.Exist(cmd.Outputs, ignoreRegExps)
+		if err != nil {
+			return fp, false, err
+		}
+
+		return fp, exist, nil
+	}
+
+	return fp, true, nil
+}
+
+// runCmdWithRetries runs cmd until it succeeds or has been retried cmd.Retries
+// times, waiting cmd.RetryDelay before the first retry and multiplying it by
+// cmd.RetryBackoff after each one. Retries are aborted as soon as ctx is done.
+// If cmd has retries, the attempt number is included in the logs.
+func runCmdWithRetries(ctx context.Context, cmd config.Cmd, label string, shouldLog, shouldLogEvents bool) error {
+	delay := float64(cmd.RetryDelay)
+
+	for attempt := 1; ; attempt++ {
+		attemptLabel := label
+		var logPrefix string
+		if cmd.Retries > 0 {
+			attemptLabel = fmt.Sprintf("%v (attempt %v/%v)", label, attempt, cmd.Retries+1)
+			logPrefix = fmt.Sprintf("(attempt %v/%v) ", attempt, cmd.Retries+1)
+		}
+
+		if shouldLogEvents {
+			logs.Evt.Printf("starting %v\n", attemptLabel)
+		}
+
+		err := runCmd(ctx, cmd, logPrefix, shouldLog)
+		if err == nil {
+			return nil
+		}
+
+		if shouldLog {
+			logs.Err.Printf("%v: %v\n", attemptLabel, err)
+		}
+
+		if attempt > cmd.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		timer := time.NewTimer(time.Duration(delay * float64(time.Millisecond)))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return err
+		case <-timer.C:
+		}
+
+		delay *= cmd.RetryBackoff
+	}
+}
+
+// runCmd runs the given cmd. If it exceeds its timeout, it's
+// stopped the same way as when ctx is done and a timeoutError is returned.
+// logPrefix is added to the prefix of the lines logged from the cmd's output.
 // ctx -> indicates that the cmd must be terminated as soon as possible.
 // cmdCtx -> indicates that the cmd must be terminated immediately.
 // cmdDone -> indicates that the cmd has completed or been terminated.
-func runCmd(ctx context.Context, cmd config.Cmd, shouldLog bool) error {
+func runCmd(ctx context.Context, cmd config.Cmd, logPrefix string, shouldLog bool) error {
 	cmdCtx, killCmd := context.WithCancel(context.Background())
 	defer killCmd()
 	cmdDone := make(chan error)
 
-	cmdExec := exec.CommandContext(cmdCtx, cmd.Terms[0], cmd.Terms[1:]...)
+	// if it isn't found, exec reports it when starting the cmd
+	cmdPath, err := lookCmdPath(cmd)
+	if err != nil {
+		cmdPath = cmd.Terms[0]
+	}
+
+	cmdExec := exec.CommandContext(cmdCtx, cmdPath, cmd.Terms[1:]...)
+	cmdExec.Args[0] = cmd.Terms[0]
+	cmdExec.Dir = cmd.Dir
+	if len(cmd.Env) > 0 {
+		cmdExec.Env = append(os.Environ(), cmd.Env...)
+	}
+	if cmd.Stdin {
+		cmdExec.Stdin = os.Stdin
+	}
 
 	if shouldLog {
 		outPipe, err := cmdExec.StdoutPipe()
 		if err != nil {
 			return err
 		}
-		go logCmdStd(cmdCtx, logs.CmdOut, outPipe)
+		go logCmdStd(cmdCtx, withPrefix(logs.CmdOut, logPrefix), outPipe)
 
 		errPipe, err := cmdExec.StderrPipe()
 		if err != nil {
 			return err
 		}
-		go logCmdStd(cmdCtx, logs.CmdErr, errPipe)
+		go logCmdStd(cmdCtx, withPrefix(logs.CmdErr, logPrefix), errPipe)
 	}
 
-	err := cmdExec.Start()
+	err = cmdExec.Start()
 	if err != nil {
 		return err
 	}
@@ -143,27 +781,61 @@ func runCmd(ctx context.Context, cmd config.Cmd, shouldLog bool) error {
 		close(cmdDone)
 	}()
 
-	select {
-	case <-ctx.Done():
-		cmdExec.Process.Signal(os.Interrupt)
+	// stop sends the kill signal to the cmd and kills
+	// it if it doesn't exit after cmd.DelayToKill.
+	stop := func() error {
+		cmdExec.Process.Signal(cmd.KillSignal)
 
 		timer := time.NewTimer(time.Duration(int(time.Millisecond) * cmd.DelayToKill))
+		defer timer.Stop()
 
 		select {
 		case <-timer.C:
 			killCmd()
 
-			if err = <-cmdDone; err != nil {
-				return err
-			}
-		case err = <-cmdDone:
+			return <-cmdDone
+		case err := <-cmdDone:
 			return err
 		}
+	}
+
+	var timeout <-chan time.Time
+	if cmd.Timeout > 0 {
+		timeoutTimer := time.NewTimer(time.Duration(int(time.Millisecond) * cmd.Timeout))
+		defer timeoutTimer.Stop()
+
+		timeout = timeoutTimer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return stop()
+	case <-timeout:
+		stop()
+
+		return timeoutError{cmd.Timeout}
 	case err := <-cmdDone:
 		return err
 	}
+}
+
+// timeoutError is the error of a cmd that was stopped for exceeding its timeout.
+type timeoutError struct {
+	// Milliseconds
+	timeout int
+}
+
+func (te timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %vms", te.timeout)
+}
+
+// withPrefix returns a logger like l whose prefix is followed by prefix.
+func withPrefix(l *log.Logger, prefix string) *log.Logger {
+	if prefix == "" {
+		return l
+	}
 
-	return nil
+	return log.New(l.Writer(), l.Prefix()+prefix, l.Flags())
 }
 
 func logCmdStd(ctx context.Context, l *log.Logger, std io.Reader) {
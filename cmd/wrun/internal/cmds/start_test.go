@@ -0,0 +1,630 @@
+package cmds
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/internal/fingerprint"
+	"github.com/efreitasn/wrun/v4/pkg/watcher"
+)
+
+// newTestCmd returns a cmd that runs script with sh in dir.
+func newTestCmd(dir, script string) config.Cmd {
+	return config.Cmd{
+		Terms:        []string{"sh", "-c", script},
+		DelayToKill:  100,
+		KillSignal:   syscall.SIGINT,
+		RetryBackoff: 1,
+		OnChange:     config.OnChangeRestart,
+		RunOnStart:   true,
+		Dir:          dir,
+	}
+}
+
+// readLines returns the lines of the file at filePath,
+// or nil if it doesn't exist.
+func readLines(t *testing.T, filePath string) []string {
+	bs, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	return strings.Fields(string(bs))
+}
+
+func TestRunCmd_timeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrun")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("stopped with the kill signal", func(t *testing.T) {
+		cmd := newTestCmd(dir, "trap 'echo term > signal; exit 0' TERM; while :; do sleep 0.01; done")
+		cmd.Timeout = 200
+		cmd.KillSignal = syscall.SIGTERM
+		cmd.DelayToKill = 5000
+
+		start := time.Now()
+		err := runCmd(context.Background(), cmd, "", false)
+		elapsed := time.Since(start)
+
+		if err != (timeoutError{200}) {
+			t.Errorf("got %v, want %v", err, timeoutError{200})
+		}
+
+		if lines := readLines(t, path.Join(dir, "signal")); len(lines) != 1 || lines[0] != "term" {
+			t.Errorf("got %v, want %v", lines, []string{"term"})
+		}
+
+		// it exited due to the signal instead of being killed
+		if elapsed >= 5*time.Second {
+			t.Errorf("took %v, want less than %v", elapsed, 5*time.Second)
+		}
+	})
+
+	t.Run("killed after delayToKill", func(t *testing.T) {
+		cmd := newTestCmd(dir, "trap 'echo int >> ignored' INT; while :; do sleep 0.01; done")
+		cmd.Timeout = 200
+		cmd.DelayToKill = 300
+
+		start := time.Now()
+		err := runCmd(context.Background(), cmd, "", false)
+		elapsed := time.Since(start)
+
+		if err != (timeoutError{200}) {
+			t.Errorf("got %v, want %v", err, timeoutError{200})
+		}
+
+		if lines := readLines(t, path.Join(dir, "ignored")); len(lines) != 1 || lines[0] != "int" {
+			t.Errorf("got %v, want %v", lines, []string{"int"})
+		}
+
+		if elapsed < 500*time.Millisecond {
+			t.Errorf("took %v, want at least %v", elapsed, 500*time.Millisecond)
+		}
+	})
+
+	t.Run("completed before the timeout", func(t *testing.T) {
+		cmd := newTestCmd(dir, "exit 0")
+		cmd.Timeout = 5000
+
+		if err := runCmd(context.Background(), cmd, "", false); err != nil {
+			t.Errorf("unexpected err: %v", err)
+		}
+	})
+}
+
+// failingScript is a script that appends a line to the attempts
+// file and fails until it has been run n times.
+func failingScript(n int) string {
+	return "echo x >> attempts; [ $(wc -l < attempts) -ge " + strconv.Itoa(n) + " ]"
+}
+
+func TestWithPrefix(t *testing.T) {
+	var buf bytes.Buffer
+	l := log.New(&buf, "CMD: ", 0)
+
+	if got := withPrefix(l, ""); got != l {
+		t.Errorf("got %v, want %v", got, l)
+	}
+
+	withPrefix(l, "(attempt 2/3) ").Print("foo\n")
+	l.Print("bar\n")
+
+	if expected := "CMD: (attempt 2/3) foo\nCMD: bar\n"; buf.String() != expected {
+		t.Errorf("got %q, want %q", buf.String(), expected)
+	}
+}
+
+func TestRunCmd_stdin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrun")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	stdinPath := path.Join(dir, "stdin")
+	err = ioutil.WriteFile(stdinPath, []byte("foo\n"), os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	stdin, err := os.Open(stdinPath)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer stdin.Close()
+
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = oldStdin }()
+
+	t.Run("not connected", func(t *testing.T) {
+		cmd := newTestCmd(dir, "cat > not-connected")
+
+		if err := runCmd(context.Background(), cmd, "", false); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if lines := readLines(t, path.Join(dir, "not-connected")); len(lines) != 0 {
+			t.Errorf("got %v, want %v", lines, []string{})
+		}
+	})
+
+	t.Run("connected", func(t *testing.T) {
+		cmd := newTestCmd(dir, "cat > connected")
+		cmd.Stdin = true
+
+		if err := runCmd(context.Background(), cmd, "", false); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if lines := readLines(t, path.Join(dir, "connected")); len(lines) != 1 || lines[0] != "foo" {
+			t.Errorf("got %v, want %v", lines, []string{"foo"})
+		}
+	})
+}
+
+func TestOpenKeyboard(t *testing.T) {
+	kb := &keyboard{}
+
+	tests := []struct {
+		name             string
+		stdin            []bool
+		expectedKeyboard *keyboard
+	}{
+		{"no cmd reads stdin", []bool{false, false}, kb},
+		{"a cmd reads stdin", []bool{false, true}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmds := make([]config.Cmd, len(test.stdin))
+			for i, stdin := range test.stdin {
+				cmds[i].Stdin = stdin
+			}
+
+			called := false
+			newKb := func() (*keyboard, error) {
+				called = true
+
+				return kb, nil
+			}
+
+			got := openKeyboard(cmds, newKb, false, false)
+
+			if got != test.expectedKeyboard {
+				t.Errorf("got %v, want %v", got, test.expectedKeyboard)
+			}
+
+			// the terminal mustn't be put in cbreak mode if a cmd reads it
+			if called != (test.expectedKeyboard != nil) {
+				t.Errorf("newKb called: %v, want %v", called, test.expectedKeyboard != nil)
+			}
+		})
+	}
+}
+
+func TestRunCmdWithRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		retries          int
+		retryDelay       int
+		retryBackoff     float64
+		failures         int
+		expectedErr      bool
+		expectedAttempts int
+		// expectedDelay is the minimum time spent waiting between attempts.
+		expectedDelay time.Duration
+	}{
+		{"no retries", 0, 0, 1, 1, true, 1, 0},
+		{"succeeds after retries", 3, 10, 1, 2, false, 3, 20 * time.Millisecond},
+		{"runs out of retries", 2, 10, 1, 5, true, 3, 20 * time.Millisecond},
+		{"backoff", 3, 50, 2, 3, false, 4, 350 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wrun")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			cmd := newTestCmd(dir, failingScript(test.failures+1))
+			cmd.Retries = test.retries
+			cmd.RetryDelay = test.retryDelay
+			cmd.RetryBackoff = test.retryBackoff
+
+			start := time.Now()
+			err = runCmdWithRetries(context.Background(), cmd, "test", false, false)
+			elapsed := time.Since(start)
+
+			if (err != nil) != test.expectedErr {
+				t.Errorf("got %v, want err: %v", err, test.expectedErr)
+			}
+
+			if attempts := len(readLines(t, path.Join(dir, "attempts"))); attempts != test.expectedAttempts {
+				t.Errorf("got %v attempts, want %v", attempts, test.expectedAttempts)
+			}
+
+			if elapsed < test.expectedDelay {
+				t.Errorf("took %v, want at least %v", elapsed, test.expectedDelay)
+			}
+		})
+	}
+
+	t.Run("aborted when ctx is done", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "wrun")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer os.RemoveAll(dir)
+
+		cmd := newTestCmd(dir, "echo x >> attempts; exit 1")
+		cmd.Retries = 5
+		cmd.RetryDelay = 5000
+
+		ctx, cancel := context.WithCancel(context.Background())
+		timer := time.AfterFunc(200*time.Millisecond, cancel)
+		defer timer.Stop()
+
+		start := time.Now()
+		err = runCmdWithRetries(ctx, cmd, "test", false, false)
+		elapsed := time.Since(start)
+
+		if err == nil {
+			t.Error("got nil, want err")
+		}
+
+		if attempts := len(readLines(t, path.Join(dir, "attempts"))); attempts != 1 {
+			t.Errorf("got %v attempts, want %v", attempts, 1)
+		}
+
+		if elapsed >= 5*time.Second {
+			t.Errorf("took %v, want less than %v", elapsed, 5*time.Second)
+		}
+	})
+}
+
+// testEvent is a modification of path.
+type testEvent struct {
+	path string
+}
+
+func (te testEvent) String() string       { return te.WatcherEvent() }
+func (te testEvent) WatcherEvent() string { return "MODIFY " + te.path }
+func (te testEvent) IsDir() bool          { return false }
+func (te testEvent) Path() string         { return te.path }
+func (te testEvent) Op() watcher.Op       { return watcher.ModifyOp }
+func (te testEvent) Time() time.Time      { return time.Time{} }
+func (te testEvent) Seq() uint64          { return 0 }
+
+// testLoop is a loop run by a test.
+type testLoop struct {
+	events chan watcher.Event
+	keys   chan byte
+	quit   chan os.Signal
+	done   chan struct{}
+}
+
+// startTestLoop runs loop with c and pending in a goroutine,
+// storing the fingerprints in dir.
+func startTestLoop(c *config.Config, dir string, pending ...watcher.Event) *testLoop {
+	tl := &testLoop{
+		events: make(chan watcher.Event),
+		keys:   make(chan byte),
+		quit:   make(chan os.Signal, 1),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		loop(c, fingerprint.NewCache(path.Join(dir, cacheDirPath)), loopInputs{
+			pending: pending,
+			events:  tl.events,
+			keys:    tl.keys,
+			quit:    tl.quit,
+		}, false, false)
+
+		close(tl.done)
+	}()
+
+	return tl
+}
+
+// stop stops the loop and waits for it to return.
+func (tl *testLoop) stop(t *testing.T) {
+	tl.quit <- os.Interrupt
+
+	select {
+	case <-tl.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop didn't return")
+	}
+}
+
+// waitForLines waits until the lines of the file at filePath are equal to
+// expected and fails if it doesn't happen within 5 seconds.
+func waitForLines(t *testing.T, filePath string, expected []string) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		lines := readLines(t, filePath)
+		if reflect.DeepEqual(lines, expected) {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("got %v, want %v", lines, expected)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectLines checks that the lines of the file at filePath are still
+// equal to expected after d.
+func expectLines(t *testing.T, filePath string, expected []string, d time.Duration) {
+	time.Sleep(d)
+
+	if lines := readLines(t, filePath); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("got %v, want %v", lines, expected)
+	}
+}
+
+func TestLoop_onChange(t *testing.T) {
+	tests := []struct {
+		onChange config.OnChange
+		expected []string
+	}{
+		// the first run is stopped
+		{config.OnChangeRestart, []string{"start", "start", "end"}},
+		// the second run starts after the first one ends
+		{config.OnChangeQueue, []string{"start", "end", "start", "end"}},
+		// there's no second run
+		{config.OnChangeIgnore, []string{"start", "end"}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.onChange), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wrun")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			cmd := newTestCmd(dir, "echo start >> log; sleep 0.5; echo end >> log")
+			cmd.DelayToKill = 50
+			cmd.OnChange = test.onChange
+
+			logPath := path.Join(dir, "log")
+			tl := startTestLoop(&config.Config{Cmds: []config.Cmd{cmd}}, dir)
+			defer tl.stop(t)
+
+			waitForLines(t, logPath, []string{"start"})
+			tl.events <- testEvent{"a.txt"}
+
+			waitForLines(t, logPath, test.expected)
+			expectLines(t, logPath, test.expected, 700*time.Millisecond)
+		})
+	}
+}
+
+func TestLoop_queuedRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrun")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := newTestCmd(dir, "echo a >> log; sleep 0.5")
+	a.OnChange = config.OnChangeQueue
+	b := newTestCmd(dir, "echo b >> log")
+
+	logPath := path.Join(dir, "log")
+	tl := startTestLoop(&config.Config{Cmds: []config.Cmd{a, b}}, dir)
+	defer tl.stop(t)
+
+	waitForLines(t, logPath, []string{"a"})
+	tl.events <- testEvent{"a.txt"}
+
+	// b, which would be restarted, isn't run until the queued run
+	expected := []string{"a", "a", "b"}
+	waitForLines(t, logPath, expected)
+	expectLines(t, logPath, expected, 300*time.Millisecond)
+}
+
+func TestLoop_whenStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		exitCode int
+		expected []string
+	}{
+		{"success", 0, []string{"fatal", "default", "onSuccess", "always"}},
+		// the remaining cmds are skipped due to fatalIfErr,
+		// except for the onFailure and always ones
+		{"failure", 1, []string{"fatal", "onFailure", "always"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wrun")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			fatal := newTestCmd(dir, "echo fatal >> log; exit "+strconv.Itoa(test.exitCode))
+			fatal.FatalIfErr = true
+			cmds := []config.Cmd{fatal}
+
+			for _, status := range []config.Status{
+				config.StatusDefault,
+				config.StatusOnSuccess,
+				config.StatusOnFailure,
+				config.StatusAlways,
+			} {
+				name := string(status)
+				if status == config.StatusDefault {
+					name = "default"
+				}
+
+				cmd := newTestCmd(dir, "echo "+name+" >> log")
+				cmd.When.Status = status
+				cmds = append(cmds, cmd)
+			}
+
+			tl := startTestLoop(&config.Config{Cmds: cmds}, dir)
+			defer tl.stop(t)
+
+			logPath := path.Join(dir, "log")
+			waitForLines(t, logPath, test.expected)
+			expectLines(t, logPath, test.expected, 300*time.Millisecond)
+		})
+	}
+}
+
+func TestLoop_whenChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrun")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := newTestCmd(dir, "echo a >> log")
+	a.When.Changed = []*regexp.Regexp{regexp.MustCompile("^a\\.go$")}
+	b := newTestCmd(dir, "echo b >> log")
+
+	logPath := path.Join(dir, "log")
+	tl := startTestLoop(&config.Config{Cmds: []config.Cmd{a, b}}, dir)
+	defer tl.stop(t)
+
+	// everything counts as changed at startup
+	expected := []string{"a", "b"}
+	waitForLines(t, logPath, expected)
+
+	tl.events <- testEvent{"b.go"}
+	expected = append(expected, "b")
+	waitForLines(t, logPath, expected)
+	expectLines(t, logPath, expected, 300*time.Millisecond)
+
+	tl.events <- testEvent{"a.go"}
+	expected = append(expected, "a", "b")
+	waitForLines(t, logPath, expected)
+
+	// everything counts as changed when rerun from the keyboard
+	tl.keys <- 'r'
+	expected = append(expected, "a", "b")
+	waitForLines(t, logPath, expected)
+	expectLines(t, logPath, expected, 300*time.Millisecond)
+}
+
+func TestLoop_pending(t *testing.T) {
+	tests := []struct {
+		name     string
+		pending  []watcher.Event
+		expected []string
+	}{
+		{"no pending events", nil, []string{"b"}},
+		// a single run, in which the cmds that don't run on start run as well
+		{"pending events", []watcher.Event{testEvent{"a.txt"}, testEvent{"b.txt"}, testEvent{"c.txt"}}, []string{"a", "b"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "wrun")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.RemoveAll(dir)
+
+			a := newTestCmd(dir, "echo a >> log")
+			a.RunOnStart = false
+			b := newTestCmd(dir, "echo b >> log")
+
+			tl := startTestLoop(&config.Config{Cmds: []config.Cmd{a, b}}, dir, test.pending...)
+			defer tl.stop(t)
+
+			logPath := path.Join(dir, "log")
+			waitForLines(t, logPath, test.expected)
+			expectLines(t, logPath, test.expected, 300*time.Millisecond)
+		})
+	}
+}
+
+func TestLoop_keys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrun")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a and b only run at startup, unless they're forced to
+	a := newTestCmd(dir, "echo a >> log")
+	a.When.Changed = []*regexp.Regexp{regexp.MustCompile("^b\\.txt$")}
+	b := newTestCmd(dir, "echo b >> log")
+	b.When.Changed = a.When.Changed
+
+	logPath := path.Join(dir, "log")
+	tl := startTestLoop(&config.Config{Cmds: []config.Cmd{a, b}}, dir)
+
+	expected := []string{"a", "b"}
+	waitForLines(t, logPath, expected)
+
+	// events are dropped while paused
+	tl.keys <- 'p'
+	tl.events <- testEvent{"b.txt"}
+	expectLines(t, logPath, expected, 300*time.Millisecond)
+
+	// the cmds are forced to rerun after resuming
+	tl.keys <- 'p'
+	expected = append(expected, "a", "b")
+	waitForLines(t, logPath, expected)
+
+	// there's no rerun if there were no events while paused
+	tl.keys <- 'p'
+	tl.keys <- 'p'
+	expectLines(t, logPath, expected, 300*time.Millisecond)
+
+	// events aren't dropped after resuming
+	tl.events <- testEvent{"b.txt"}
+	expected = append(expected, "a", "b")
+	waitForLines(t, logPath, expected)
+
+	tl.keys <- 'r'
+	expected = append(expected, "a", "b")
+	waitForLines(t, logPath, expected)
+
+	tl.keys <- '2'
+	expected = append(expected, "b")
+	waitForLines(t, logPath, expected)
+
+	// there's no third cmd
+	tl.keys <- '3'
+	expectLines(t, logPath, expected, 300*time.Millisecond)
+
+	tl.keys <- 'q'
+
+	select {
+	case <-tl.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop didn't return")
+	}
+}
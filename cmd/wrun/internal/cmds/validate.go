@@ -0,0 +1,38 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/internal/logs"
+)
+
+// Validate executes the validate command.
+// It exits with a non-zero status if the config file is invalid.
+func Validate(cts *cfop.CmdTermsSet) {
+	configFilePath, err := config.FindConfigFile(cts.GetOptString("file"))
+	if err != nil {
+		logs.Err.Printf("config file: %v\n", err)
+		os.Exit(1)
+	}
+
+	_, err = config.GetConfig(configFilePath, profileName(cts))
+	if err == nil {
+		fmt.Printf("%v is valid\n", configFilePath)
+
+		return
+	}
+
+	errs, ok := err.(config.ValidationErrors)
+	if !ok {
+		logs.Err.Printf("%v: %v\n", configFilePath, err)
+		os.Exit(1)
+	}
+
+	for _, e := range errs {
+		logs.Err.Println(e)
+	}
+	os.Exit(1)
+}
@@ -0,0 +1,110 @@
+package cmds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/efreitasn/cfop"
+	"github.com/efreitasn/wrun/v4/internal/config"
+	"github.com/efreitasn/wrun/v4/internal/logs"
+	"github.com/efreitasn/wrun/v4/pkg/watcher"
+)
+
+// Why executes the why command for the given paths.
+func Why(cts *cfop.CmdTermsSet, paths []string) {
+	// Config
+	c, err := getConfig(cts)
+	if err != nil {
+		logs.Err.Printf("config file: %v\n", err)
+
+		return
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		logs.Err.Println(err)
+
+		return
+	}
+
+	for _, p := range paths {
+		relPath, isDir, err := watchedPath(c.Root, wd, p)
+		if err != nil {
+			fmt.Printf("%v: %v\n", p, err)
+
+			continue
+		}
+
+		rx, matchedPath := watcher.IgnoredBy(relPath, isDir, c.IgnoreRegExps)
+		if rx != nil {
+			source := "config"
+			if config.IsBuiltinIgnoreRegExp(rx) {
+				source = "built-in"
+			}
+
+			fmt.Printf("%v: ignored\n", p)
+			fmt.Printf("  %v matches %v (%v)\n", matchedPath, rx, source)
+
+			continue
+		}
+
+		fmt.Printf("%v: watched\n", p)
+
+		if relPath == "." {
+			continue
+		}
+
+		for i, cmdItem := range c.Cmds {
+			label := cmdLabel(i, cmdItem)
+			terms := strings.Join(cmdItem.Terms, " ")
+			paths := []string{relPath}
+
+			if cmdItem.When.Changed != nil && !matchesAny(cmdItem.When.Changed, paths) {
+				fmt.Printf("  doesn't run %v (%v), it doesn't match its when.changed\n", label, terms)
+
+				continue
+			}
+
+			if cmdItem.Inputs != nil && !matchesAny(cmdItem.Inputs, paths) {
+				fmt.Printf("  doesn't affect %v (%v), it doesn't match its inputs\n", label, terms)
+
+				continue
+			}
+
+			fmt.Printf("  triggers %v (%v)\n", label, terms)
+		}
+	}
+}
+
+// watchedPath returns p, which is relative to wd, relative to the watched
+// directory rootPath and whether it's a directory. A path that doesn't exist
+// is considered a directory only if it has a trailing slash.
+func watchedPath(rootPath, wd, p string) (relPath string, isDir bool, err error) {
+	absPath := p
+	if !filepath.IsAbs(absPath) {
+		absPath = filepath.Join(wd, p)
+	}
+
+	relPath, err = filepath.Rel(rootPath, absPath)
+	if err != nil {
+		return "", false, err
+	}
+
+	if relPath == ".." || strings.HasPrefix(relPath, "../") {
+		return "", false, fmt.Errorf("outside of %v", rootPath)
+	}
+
+	info, err := os.Stat(absPath)
+	switch {
+	case err == nil:
+		isDir = info.IsDir()
+	case os.IsNotExist(err):
+		isDir = strings.HasSuffix(p, "/")
+	default:
+		return "", false, err
+	}
+
+	return relPath, isDir, nil
+}
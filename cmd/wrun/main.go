@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"strings"
 
 	"github.com/efreitasn/cfop"
 	"github.com/efreitasn/wrun/v4/cmd/wrun/internal/cmds"
@@ -17,9 +18,33 @@ func main() {
 func startCmd(args []string) error {
 	set := cfop.NewSubcmdsSet()
 
+	// cfop doesn't support --, so the terms of the
+	// command to be run are removed before parsing.
+	var runTerms []string
+	if len(args) > 1 && args[1] == "run" {
+		for i, arg := range args {
+			if arg == "--" {
+				runTerms = args[i+1:]
+				args = args[:i]
+
+				break
+			}
+		}
+	}
+
+	// cfop only supports a fixed number of arguments, so
+	// all but the first path are removed before parsing.
+	var whyPaths []string
+	if len(args) > 2 && args[1] == "why" {
+		var whyTerms []string
+		whyTerms, whyPaths = splitArgs(args[2:], "f", "file", "r", "root", "p", "profile")
+
+		args = append(args[:2:2], whyTerms...)
+	}
+
 	set.Add(
 		"start",
-		"Starts watching files in the current directory.",
+		"Starts watching files in the directory of the config file or in the root directory.",
 		cfop.NewCmd(cfop.CmdConfig{
 			Fn: cmds.Start,
 			Options: []cfop.CmdOption{
@@ -29,6 +54,24 @@ func startCmd(args []string) error {
 					Alias:       "f",
 					Description: "path for the config file",
 				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "root",
+					Alias:       "r",
+					Description: "path for the directory to be watched, overrides the root field",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "profile",
+					Alias:       "p",
+					Description: "profile to be applied to the config file, defaults to the WRUN_PROFILE environment variable",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "task",
+					Alias:       "t",
+					Description: "comma-separated names of the cmds to be run, all of them by default",
+				},
 			},
 			Flags: []cfop.CmdFlag{
 				cfop.CmdFlag{
@@ -41,15 +84,214 @@ func startCmd(args []string) error {
 					Alias:       "q",
 					Description: "whether to log anything at all",
 				},
+				cfop.CmdFlag{
+					Name:        "no-initial-run",
+					Alias:       "ni",
+					Description: "whether to only run the cmds after a change happens",
+				},
+			},
+		}),
+	)
+
+	set.Add(
+		"run",
+		"Runs the command after -- whenever the contents in the current directory change, without a config file",
+		cfop.NewCmd(cfop.CmdConfig{
+			Fn: func(cts *cfop.CmdTermsSet) {
+				cmds.Run(cts, runTerms)
+			},
+			Options: []cfop.CmdOption{
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "include",
+					Alias:       "i",
+					Description: "comma-separated glob patterns of the paths whose changes trigger the command",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "ignore",
+					Alias:       "x",
+					Description: "comma-separated glob patterns of the paths to be ignored",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "delay",
+					Alias:       "d",
+					Description: "time in milliseconds to wait after sending the signal and before killing the command",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "signal",
+					Alias:       "s",
+					Description: "signal sent to stop the command, defaults to SIGINT",
+				},
+			},
+			Flags: []cfop.CmdFlag{
+				cfop.CmdFlag{
+					Name:        "no-events",
+					Alias:       "ne",
+					Description: "whether to log events",
+				},
+				cfop.CmdFlag{
+					Name:        "quiet",
+					Alias:       "q",
+					Description: "whether to log anything at all",
+				},
+				cfop.CmdFlag{
+					Name:        "no-initial-run",
+					Alias:       "ni",
+					Description: "whether to only run the cmds after a change happens",
+				},
+			},
+		}),
+	)
+
+	set.Add(
+		"doctor",
+		"Diagnoses the environment used for watching the current directory",
+		cfop.NewCmd(cfop.CmdConfig{
+			Fn: cmds.Doctor,
+			Options: []cfop.CmdOption{
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "file",
+					Alias:       "f",
+					Description: "path for the config file",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "root",
+					Alias:       "r",
+					Description: "path for the directory to be watched, overrides the root field",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "profile",
+					Alias:       "p",
+					Description: "profile to be applied to the config file, defaults to the WRUN_PROFILE environment variable",
+				},
+			},
+		}),
+	)
+
+	set.Add(
+		"why",
+		"Explains whether and why paths are ignored and which cmds they trigger",
+		cfop.NewCmd(cfop.CmdConfig{
+			Fn: func(cts *cfop.CmdTermsSet) {
+				cmds.Why(cts, whyPaths)
+			},
+			Options: []cfop.CmdOption{
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "file",
+					Alias:       "f",
+					Description: "path for the config file",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "root",
+					Alias:       "r",
+					Description: "path for the directory to be watched, overrides the root field",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "profile",
+					Alias:       "p",
+					Description: "profile to be applied to the config file, defaults to the WRUN_PROFILE environment variable",
+				},
+			},
+			Args: []cfop.CmdArg{
+				cfop.CmdArg{
+					T:           cfop.TermString,
+					Name:        "path",
+					Description: "path to be explained, more can follow",
+				},
 			},
 		}),
 	)
 
+	set.Add(
+		"ls",
+		"Prints the tree of watched directories",
+		cfop.NewCmd(cfop.CmdConfig{
+			Fn: cmds.Ls,
+			Options: []cfop.CmdOption{
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "file",
+					Alias:       "f",
+					Description: "path for the config file",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "root",
+					Alias:       "r",
+					Description: "path for the directory to be watched, overrides the root field",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "profile",
+					Alias:       "p",
+					Description: "profile to be applied to the config file, defaults to the WRUN_PROFILE environment variable",
+				},
+			},
+			Flags: []cfop.CmdFlag{
+				cfop.CmdFlag{
+					Name:        "flat",
+					Description: "whether to print a flat list instead of a tree",
+				},
+				cfop.CmdFlag{
+					Name:        "json",
+					Description: "whether to print the tree as JSON",
+				},
+			},
+		}),
+	)
+
+	set.Add(
+		"validate",
+		"Validates the config file",
+		cfop.NewCmd(cfop.CmdConfig{
+			Fn: cmds.Validate,
+			Options: []cfop.CmdOption{
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "file",
+					Alias:       "f",
+					Description: "path for the config file",
+				},
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "profile",
+					Alias:       "p",
+					Description: "profile to be applied to the config file, defaults to the WRUN_PROFILE environment variable",
+				},
+			},
+		}),
+	)
+
+	set.Add(
+		"schema",
+		"Prints the JSON schema of the config file",
+		cfop.NewCmd(cfop.CmdConfig{
+			Fn: cmds.Schema,
+		}),
+	)
+
 	set.Add(
 		"init",
 		"Creates a config file in the current directory",
 		cfop.NewCmd(cfop.CmdConfig{
 			Fn: cmds.Init,
+			Options: []cfop.CmdOption{
+				cfop.CmdOption{
+					T:           cfop.TermString,
+					Name:        "template",
+					Alias:       "t",
+					Description: "template for the config file (go, node, python, rust, make or a user-defined one), detected from the files in the current directory by default",
+				},
+			},
 		}),
 	)
 
@@ -73,3 +315,36 @@ func startCmd(args []string) error {
 
 	return nil
 }
+
+// splitArgs returns terms without all but the first argument, along with all
+// the arguments. Options in optsWithValue are expected to be followed by
+// their value, unless it's provided as --opt=value.
+func splitArgs(terms []string, optsWithValue ...string) (termsWithoutArgs, args []string) {
+	for i := 0; i < len(terms); i++ {
+		term := terms[i]
+
+		if strings.HasPrefix(term, "-") {
+			termsWithoutArgs = append(termsWithoutArgs, term)
+
+			optName := strings.TrimLeft(term, "-")
+			for _, optWithValue := range optsWithValue {
+				if optName == optWithValue && i+1 < len(terms) {
+					i++
+					termsWithoutArgs = append(termsWithoutArgs, terms[i])
+
+					break
+				}
+			}
+
+			continue
+		}
+
+		if len(args) == 0 {
+			termsWithoutArgs = append(termsWithoutArgs, term)
+		}
+
+		args = append(args, term)
+	}
+
+	return termsWithoutArgs, args
+}
@@ -5,6 +5,7 @@ go 1.14
 require (
 	github.com/efreitasn/cfop v1.1.0
 	github.com/efreitasn/customo v1.0.0
+	github.com/pelletier/go-toml v1.9.5
 	golang.org/x/sys v0.0.0-20191228213918-04cbcbbfeed8
-	gopkg.in/yaml.v2 v2.2.8
+	gopkg.in/yaml.v3 v3.0.1
 )
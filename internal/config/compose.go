@@ -0,0 +1,407 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// loader loads config files along with the files they extend and include.
+type loader struct {
+	// stack are the absolute paths of the files being loaded,
+	// used to detect cycles.
+	stack []string
+	// origins maps every node loaded to the path of its file.
+	origins map[*yaml.Node]string
+}
+
+func newLoader() *loader {
+	return &loader{
+		origins: map[*yaml.Node]string{},
+	}
+}
+
+// load returns the node of the config file at filePath merged with the
+// files it extends and includes. If these fields are invalid, the error
+// is a ValidationErrors.
+func (l *loader) load(filePath string) (*yaml.Node, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, stackPath := range l.stack {
+		if stackPath == absPath {
+			cycle := append(l.stack[i:], absPath)
+
+			return nil, fmt.Errorf("cycle between config files: %v", strings.Join(cycle, " -> "))
+		}
+	}
+
+	l.stack = append(l.stack, absPath)
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parseContent(content, formatOf(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", filePath, err)
+	}
+
+	node := root
+	switch {
+	case node.Kind == 0:
+		// empty config file
+		node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	case node.Kind == yaml.DocumentNode:
+		node = node.Content[0]
+	}
+
+	l.setOrigin(node, filePath)
+
+	if node.Kind != yaml.MappingNode {
+		return node, nil
+	}
+
+	dirPath := filepath.Dir(filePath)
+	var errs ValidationErrors
+
+	newErr := func(path string, node *yaml.Node, format string, a ...interface{}) {
+		errs = append(errs, &ValidationError{
+			File:   filePath,
+			Path:   path,
+			Line:   node.Line,
+			Column: node.Column,
+			Msg:    fmt.Sprintf(format, a...),
+		})
+	}
+
+	res := node
+
+	if extendsNode := mappingValue(node, "extends"); extendsNode != nil {
+		if extendsNode.Kind != yaml.ScalarNode || extendsNode.ShortTag() != "!!str" {
+			newErr("extends", extendsNode, "must be a string")
+		} else if base, err := l.load(filepath.Join(dirPath, extendsNode.Value)); err != nil {
+			if baseErrs, ok := err.(ValidationErrors); ok {
+				errs = append(errs, baseErrs...)
+			} else {
+				newErr("extends", extendsNode, "%v", err)
+			}
+		} else {
+			res = overlayNodes(base, res)
+		}
+	}
+
+	if includeNode := mappingValue(node, "include"); includeNode != nil {
+		if includeNode.Kind != yaml.SequenceNode {
+			newErr("include", includeNode, "must be an array")
+		} else {
+			for i, itemNode := range includeNode.Content {
+				path := fmt.Sprintf("include[%v]", i)
+
+				if itemNode.Kind != yaml.ScalarNode || itemNode.ShortTag() != "!!str" {
+					newErr(path, itemNode, "must be a string")
+
+					continue
+				}
+
+				included, err := l.load(filepath.Join(dirPath, itemNode.Value))
+				if err != nil {
+					if includedErrs, ok := err.(ValidationErrors); ok {
+						errs = append(errs, includedErrs...)
+					} else {
+						newErr(path, itemNode, "%v", err)
+					}
+
+					continue
+				}
+
+				res = includeNodes(res, included)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	res = withoutFields(res, "extends", "include")
+	l.origins[res] = filePath
+
+	return res, nil
+}
+
+// setOrigin sets filePath as the origin of node and all of its descendants.
+func (l *loader) setOrigin(node *yaml.Node, filePath string) {
+	l.origins[node] = filePath
+
+	for _, child := range node.Content {
+		l.setOrigin(child, filePath)
+	}
+}
+
+// localConfigFilePath returns the path of the file with the local overrides
+// of the config file at filePath, e.g. wrun.local.yaml for wrun.yaml.
+func localConfigFilePath(filePath string) string {
+	ext := filepath.Ext(filePath)
+
+	return strings.TrimSuffix(filePath, ext) + ".local" + ext
+}
+
+// localConfigFilesPattern is the .gitignore pattern
+// that matches the local config files.
+const localConfigFilesPattern = "wrun.local.*"
+
+// GitIgnoreLocalConfigFiles adds a pattern that matches the local config
+// files to the .gitignore file of dirPath if dirPath is the root of a git
+// repository and the pattern isn't there yet. The .gitignore file is created
+// if it doesn't exist. It returns whether the pattern was added.
+func GitIgnoreLocalConfigFiles(dirPath string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dirPath, ".git")); err != nil {
+		return false, nil
+	}
+
+	gitignorePath := filepath.Join(dirPath, ".gitignore")
+
+	content, err := ioutil.ReadFile(gitignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == localConfigFilesPattern {
+			return false, nil
+		}
+	}
+
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content, '\n')
+	}
+	content = append(content, localConfigFilesPattern+"\n"...)
+
+	if err := ioutil.WriteFile(gitignorePath, content, 0666); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// loadWithLocal loads the config file at filePath with the overrides from
+// its local config file, if it exists.
+func (l *loader) loadWithLocal(filePath string) (*yaml.Node, error) {
+	node, err := l.load(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	localFilePath := localConfigFilePath(filePath)
+	if _, err := os.Stat(localFilePath); err != nil {
+		if os.IsNotExist(err) {
+			return node, nil
+		}
+
+		return nil, err
+	}
+
+	local, err := l.load(localFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	res := overlayNodes(node, local)
+	l.origins[res] = filePath
+
+	return res, nil
+}
+
+// overlayNodes merges the fields of top into the ones of base. Fields in top
+// override the ones in base, except for ignoreRegExps, which are concatenated.
+// If any of them isn't a mapping, top is returned.
+func overlayNodes(base, top *yaml.Node) *yaml.Node {
+	return mergeNodes(base, top, false)
+}
+
+// includeNodes merges the fields of included into the ones of host. Fields in
+// host are kept, except for ignoreRegExps and cmds, which are concatenated. If
+// any of them isn't a mapping, host is returned.
+func includeNodes(host, included *yaml.Node) *yaml.Node {
+	return mergeNodes(host, included, true)
+}
+
+// mergeNodes merges the fields of b into the ones of a. If include is true, the
+// fields in a are kept and the cmds are concatenated. Otherwise, the fields in b
+// override the ones in a.
+func mergeNodes(a, b *yaml.Node, include bool) *yaml.Node {
+	if a.Kind != yaml.MappingNode || b.Kind != yaml.MappingNode {
+		if include {
+			return a
+		}
+
+		return b
+	}
+
+	// the position is the one of the file being loaded
+	pos := b
+	if include {
+		pos = a
+	}
+
+	res := &yaml.Node{
+		Kind:    yaml.MappingNode,
+		Tag:     "!!map",
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Content: append([]*yaml.Node{}, a.Content...),
+	}
+
+	for i := 0; i+1 < len(b.Content); i += 2 {
+		key, value := b.Content[i], b.Content[i+1]
+
+		j := fieldIndex(res, key.Value)
+		if j == -1 {
+			res.Content = append(res.Content, key, value)
+
+			continue
+		}
+
+		concat := key.Value == "ignoreRegExps" || (include && key.Value == "cmds")
+		existing := res.Content[j+1]
+
+		switch {
+		case concat && existing.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode:
+			res.Content[j+1] = &yaml.Node{
+				Kind:    yaml.SequenceNode,
+				Tag:     "!!seq",
+				Line:    existing.Line,
+				Column:  existing.Column,
+				Content: append(append([]*yaml.Node{}, existing.Content...), value.Content...),
+			}
+		case !include:
+			res.Content[j], res.Content[j+1] = key, value
+		}
+	}
+
+	return res
+}
+
+// fieldIndex returns the index of the key of the field named name
+// in node, which must be a mapping, or -1 if there's no such field.
+func fieldIndex(node *yaml.Node, name string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// withoutFields returns a copy of node without the given fields.
+func withoutFields(node *yaml.Node, names ...string) *yaml.Node {
+	res := *node
+	res.Content = nil
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		skip := false
+
+		for _, name := range names {
+			if node.Content[i].Value == name {
+				skip = true
+			}
+		}
+
+		if !skip {
+			res.Content = append(res.Content, node.Content[i], node.Content[i+1])
+		}
+	}
+
+	return &res
+}
+
+// applyProfile merges the profile named name from the profiles field of root
+// into root. The fields in the profile override the ones in root, except for
+// ignoreRegExps, which are concatenated, and cmds, which override the cmds
+// with the same name or, if there's none, are appended to them. The profiles
+// field is removed from the result.
+func (l *loader) applyProfile(root *yaml.Node, name string) (*yaml.Node, error) {
+	var profile *yaml.Node
+	if profiles := mappingValue(root, "profiles"); profiles != nil && profiles.Kind == yaml.MappingNode {
+		profile = mappingValue(profiles, name)
+	}
+
+	if profile == nil {
+		return nil, fmt.Errorf("profile %v doesn't exist", name)
+	}
+
+	if profile.Kind != yaml.MappingNode {
+		// reported when validating
+		return root, nil
+	}
+
+	res := overlayNodes(root, withoutFields(profile, "cmds"))
+
+	if k := fieldIndex(profile, "cmds"); k != -1 {
+		cmds := profile.Content[k+1]
+
+		j := fieldIndex(res, "cmds")
+		if j != -1 && res.Content[j+1].Kind == yaml.SequenceNode && cmds.Kind == yaml.SequenceNode {
+			res.Content[j+1] = l.mergeCmds(res.Content[j+1], cmds)
+		} else {
+			res = overlayNodes(res, &yaml.Node{
+				Kind:    yaml.MappingNode,
+				Tag:     "!!map",
+				Content: profile.Content[k : k+2],
+			})
+		}
+	}
+
+	res = withoutFields(res, "profiles")
+	l.origins[res] = l.origins[root]
+
+	return res, nil
+}
+
+// mergeCmds returns the cmds in base with the ones in top merged into them by
+// name. Cmds in top without a counterpart in base are appended.
+func (l *loader) mergeCmds(base, top *yaml.Node) *yaml.Node {
+	res := &yaml.Node{
+		Kind:    yaml.SequenceNode,
+		Tag:     "!!seq",
+		Line:    base.Line,
+		Column:  base.Column,
+		Content: append([]*yaml.Node{}, base.Content...),
+	}
+
+	for _, cmd := range top.Content {
+		i := -1
+		if name := mappingValue(cmd, "name"); name != nil {
+			for j, baseCmd := range res.Content {
+				if baseName := mappingValue(baseCmd, "name"); baseName != nil && baseName.Value == name.Value {
+					i = j
+
+					break
+				}
+			}
+		}
+
+		if i == -1 {
+			res.Content = append(res.Content, cmd)
+
+			continue
+		}
+
+		res.Content[i] = overlayNodes(res.Content[i], cmd)
+		l.origins[res.Content[i]] = l.origins[cmd]
+	}
+
+	return res
+}
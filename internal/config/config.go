@@ -4,79 +4,412 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
 
-	"gopkg.in/yaml.v2"
+	"github.com/efreitasn/wrun/v4/internal/glob"
+	"golang.org/x/sys/unix"
+	"gopkg.in/yaml.v3"
 )
 
 var defaultDelayToKill = 1000
+var defaultRenameWindow = 100
+var defaultPollInterval = 1000
+var defaultRetryDelay = 1000
+var defaultRetryBackoff = 2.0
+var defaultKillSignal = syscall.SIGINT
 var defaultConfigFilePaths = []string{
 	"wrun.yaml",
 	"wrun.yml",
+	"wrun.json",
+	"wrun.toml",
 }
 
+// vcsDirNames are the names of the entries that
+// identify the root of a repository.
+var vcsDirNames = []string{".git", ".hg", ".svn"}
+
 var alwaysIgnoreRegExps = []*regexp.Regexp{
-	regexp.MustCompile("wrun\\.(?:(?:yml)|(?:yaml))$"),
+	regexp.MustCompile("wrun\\.(?:local\\.)?(?:(?:yml)|(?:yaml)|(?:json)|(?:toml))$"),
 	regexp.MustCompile("(?:^\\..*)|(?:/\\.)"),
 }
 
 type configFileCmd struct {
-	DelayToKill *int     `yaml:"delayToKill"`
-	FatalIfErr  *bool    `yaml:"fatalIfErr"`
-	Terms       []string `yaml:"terms"`
+	Name         string          `yaml:"name,omitempty" desc:"Name of the command, used to select it with --task and to override it in a profile. Must be unique."`
+	DelayToKill  *int            `yaml:"delayToKill" schema:"ref=#/properties/delayToKill"`
+	FatalIfErr   *bool           `yaml:"fatalIfErr" schema:"ref=#/properties/fatalIfErr"`
+	Timeout      *int            `yaml:"timeout,omitempty" schema:"ref=#/properties/timeout"`
+	Retries      *int            `yaml:"retries,omitempty" schema:"ref=#/properties/retries"`
+	RetryDelay   *int            `yaml:"retryDelay,omitempty" schema:"ref=#/properties/retryDelay"`
+	RetryBackoff *float64        `yaml:"retryBackoff,omitempty" schema:"ref=#/properties/retryBackoff"`
+	RunOnStart   *bool           `yaml:"runOnStart,omitempty" schema:"ref=#/properties/runOnStart"`
+	OnChange     string          `yaml:"onChange,omitempty" schema:"ref=#/properties/onChange"`
+	Terms        []string        `yaml:"terms" schema:"required,minItems=1" desc:"The terms of a command." examples:"[[\"echo\", \"hello\", \"world\"]]"`
+	Inputs       []string        `yaml:"inputs,omitempty" desc:"List of glob patterns matching the files the command depends on. When set, the command is skipped if these files and its terms are the same as in its last successful run." examples:"[[\"**/*.go\", \"go.mod\"]]"`
+	Outputs      []string        `yaml:"outputs,omitempty" desc:"List of glob patterns matching the files the command creates. The command isn't skipped if any of these patterns doesn't match a file."`
+	Env          []string        `yaml:"env,omitempty" desc:"List of environment variables in the KEY=VALUE format to be set for the command, in addition to the ones wrun was started with. A PATH set here is also used to find the command." examples:"[[\"GOFLAGS=-race\", \"PORT=${PORT:-8080}\"]]"`
+	Dir          string          `yaml:"dir,omitempty" desc:"Directory in which the command runs, relative to the watched directory. Defaults to the watched directory."`
+	Stdin        bool            `yaml:"stdin,omitempty" desc:"Whether to connect the standard input of wrun to the command while it runs, e.g. to answer a prompt or use a REPL. Keyboard controls are disabled if any command sets it. Commands run one at a time, so several of them can set it."`
+	When         *configFileWhen `yaml:"when,omitempty" desc:"Conditions for the command to run. By default, it runs unless a previous command failed and has fatalIfErr set."`
+}
+
+type configFileWhen struct {
+	Changed []string `yaml:"changed,omitempty" desc:"List of glob patterns. The command only runs if a path that matches any of them has changed since the last completed run or if it's the first run." examples:"[[\"go.mod\", \"go.sum\"]]"`
+	Status  string   `yaml:"status,omitempty" schema:"enum=onSuccess|onFailure|always" desc:"Status of the previous commands required for the command to run. onSuccess runs it only if none of them failed, onFailure only if any of them failed, even if the remaining commands are skipped due to fatalIfErr, and always runs it regardless."`
 }
 
 type configFileData struct {
-	DelayToKill   *int            `yaml:"delayToKill"`
-	FatalIfErr    bool            `yaml:"fatalIfErr"`
-	Cmds          []configFileCmd `yaml:"cmds"`
-	IgnoreRegExps []string        `yaml:"ignoreRegExps"`
+	Schema              string                       `yaml:"$schema,omitempty"`
+	Extends             string                       `yaml:"extends,omitempty" desc:"Path of a config file whose fields are overridden by the ones in this file, relative to this file. ignoreRegExps are concatenated."`
+	Include             []string                     `yaml:"include,omitempty" desc:"Paths of config files whose cmds and ignoreRegExps are appended to the ones in this file, relative to this file. Their other fields are only used if this file doesn't have them."`
+	DelayToKill         *int                         `yaml:"delayToKill" schema:"minimum=0" desc:"Time in milliseconds to wait after sending a SIGINT and before sending a SIGKILL to a command. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to 1000."`
+	FatalIfErr          bool                         `yaml:"fatalIfErr" desc:"Whether to skip subsequent commands in case the current one returns an error. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to false."`
+	Timeout             *int                         `yaml:"timeout,omitempty" schema:"minimum=0" desc:"Time in milliseconds after which a command is stopped and considered to have failed. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to 0, which means no timeout."`
+	Retries             *int                         `yaml:"retries,omitempty" schema:"minimum=0" desc:"Number of times a failed command is run again before it's considered to have failed. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to 0."`
+	RetryDelay          *int                         `yaml:"retryDelay,omitempty" schema:"minimum=0" desc:"Time in milliseconds to wait before the first retry of a failed command. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to 1000."`
+	RetryBackoff        *float64                     `yaml:"retryBackoff,omitempty" schema:"minimum=1" desc:"Factor by which the time to wait is multiplied after each retry. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to 2."`
+	RunOnStart          *bool                        `yaml:"runOnStart,omitempty" desc:"Whether to run a command at startup, before any change happens. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to true."`
+	OnChange            string                       `yaml:"onChange,omitempty" schema:"enum=restart|queue|ignore" desc:"What happens when a change happens while a command is running. restart stops it and runs the commands again, queue lets the commands finish and then runs them again once, and ignore discards the change. Can be defined both command-wide and global-wide. The command version, if it exists, takes precedence. Defaults to restart."`
+	Cmds                []configFileCmd              `yaml:"cmds" schema:"required,minItems=1" desc:"List of commands to be executed sequentially."`
+	IgnoreRegExps       []string                     `yaml:"ignoreRegExps" desc:"List of regular expressions to be ignored when watching."`
+	SkipUnchangedWrites bool                         `yaml:"skipUnchangedWrites,omitempty" desc:"Whether to ignore writes that don't change the content of a file. Defaults to false."`
+	HashSizeLimit       int64                        `yaml:"hashSizeLimit,omitempty" schema:"minimum=0" desc:"Size in bytes above which files are compared by size and modification time instead of by the hash of their content when skipUnchangedWrites is true. Defaults to 4194304 (4 MiB)."`
+	Snapshot            bool                         `yaml:"snapshot,omitempty" desc:"Whether to report changes made while wrun wasn't running. Defaults to false."`
+	RenameWindow        *int                         `yaml:"renameWindow,omitempty" schema:"minimum=1" desc:"Time in milliseconds to wait for the IN_MOVED_TO event that pairs with an IN_MOVED_FROM event. Defaults to 100."`
+	SplitRenames        bool                         `yaml:"splitRenames,omitempty" desc:"Whether to report items moved into or out of the watched directory as CREATE or DELETE instead of RENAME. Defaults to false."`
+	PollFallback        bool                         `yaml:"pollFallback,omitempty" desc:"Whether to poll the directories that can't be watched because the inotify watch limit has been reached. Defaults to false."`
+	PollInterval        *int                         `yaml:"pollInterval,omitempty" schema:"minimum=1" desc:"Time in milliseconds between two polls of the directories that couldn't be watched when pollFallback is true. Defaults to 1000."`
+	Root                string                       `yaml:"root,omitempty" desc:"Directory to be watched, relative to the directory of the config file. Defaults to the directory of the config file."`
+	Profiles            map[string]configFileProfile `yaml:"profiles,omitempty" desc:"Variants of the config selected with --profile or WRUN_PROFILE. A profile's fields override the config's, except for ignoreRegExps, which are appended, and cmds, which override the cmds with the same name or are appended."`
+}
+
+// configFileProfile is an entry of the profiles field. Its cmds are
+// matched by name with the ones from the config.
+type configFileProfile struct {
+	DelayToKill         *int                   `yaml:"delayToKill,omitempty" schema:"ref=#/properties/delayToKill"`
+	FatalIfErr          *bool                  `yaml:"fatalIfErr,omitempty" schema:"ref=#/properties/fatalIfErr"`
+	Timeout             *int                   `yaml:"timeout,omitempty" schema:"ref=#/properties/timeout"`
+	Retries             *int                   `yaml:"retries,omitempty" schema:"ref=#/properties/retries"`
+	RetryDelay          *int                   `yaml:"retryDelay,omitempty" schema:"ref=#/properties/retryDelay"`
+	RetryBackoff        *float64               `yaml:"retryBackoff,omitempty" schema:"ref=#/properties/retryBackoff"`
+	RunOnStart          *bool                  `yaml:"runOnStart,omitempty" schema:"ref=#/properties/runOnStart"`
+	OnChange            string                 `yaml:"onChange,omitempty" schema:"ref=#/properties/onChange"`
+	Cmds                []configFileProfileCmd `yaml:"cmds,omitempty" desc:"Commands that override the ones with the same name or, if there's none, are appended to them."`
+	IgnoreRegExps       []string               `yaml:"ignoreRegExps,omitempty" desc:"List of regular expressions appended to the ones of the config."`
+	SkipUnchangedWrites *bool                  `yaml:"skipUnchangedWrites,omitempty" schema:"ref=#/properties/skipUnchangedWrites"`
+	HashSizeLimit       *int64                 `yaml:"hashSizeLimit,omitempty" schema:"ref=#/properties/hashSizeLimit"`
+	Snapshot            *bool                  `yaml:"snapshot,omitempty" schema:"ref=#/properties/snapshot"`
+	RenameWindow        *int                   `yaml:"renameWindow,omitempty" schema:"ref=#/properties/renameWindow"`
+	SplitRenames        *bool                  `yaml:"splitRenames,omitempty" schema:"ref=#/properties/splitRenames"`
+	PollFallback        *bool                  `yaml:"pollFallback,omitempty" schema:"ref=#/properties/pollFallback"`
+	PollInterval        *int                   `yaml:"pollInterval,omitempty" schema:"ref=#/properties/pollInterval"`
+	Root                string                 `yaml:"root,omitempty" schema:"ref=#/properties/root"`
+}
+
+// configFileProfileCmd is a cmd from a profile. Unlike configFileCmd,
+// its terms are optional, since it can override an existing cmd.
+type configFileProfileCmd struct {
+	Name         string          `yaml:"name" schema:"required,ref=#/properties/cmds/items/properties/name"`
+	DelayToKill  *int            `yaml:"delayToKill,omitempty" schema:"ref=#/properties/delayToKill"`
+	FatalIfErr   *bool           `yaml:"fatalIfErr,omitempty" schema:"ref=#/properties/fatalIfErr"`
+	Timeout      *int            `yaml:"timeout,omitempty" schema:"ref=#/properties/timeout"`
+	Retries      *int            `yaml:"retries,omitempty" schema:"ref=#/properties/retries"`
+	RetryDelay   *int            `yaml:"retryDelay,omitempty" schema:"ref=#/properties/retryDelay"`
+	RetryBackoff *float64        `yaml:"retryBackoff,omitempty" schema:"ref=#/properties/retryBackoff"`
+	RunOnStart   *bool           `yaml:"runOnStart,omitempty" schema:"ref=#/properties/runOnStart"`
+	OnChange     string          `yaml:"onChange,omitempty" schema:"ref=#/properties/onChange"`
+	Terms        []string        `yaml:"terms,omitempty" schema:"ref=#/properties/cmds/items/properties/terms"`
+	Inputs       []string        `yaml:"inputs,omitempty" schema:"ref=#/properties/cmds/items/properties/inputs"`
+	Outputs      []string        `yaml:"outputs,omitempty" schema:"ref=#/properties/cmds/items/properties/outputs"`
+	Env          []string        `yaml:"env,omitempty" schema:"ref=#/properties/cmds/items/properties/env"`
+	Dir          string          `yaml:"dir,omitempty" schema:"ref=#/properties/cmds/items/properties/dir"`
+	Stdin        bool            `yaml:"stdin,omitempty" schema:"ref=#/properties/cmds/items/properties/stdin"`
+	When         *configFileWhen `yaml:"when,omitempty" schema:"ref=#/properties/cmds/items/properties/when"`
 }
 
 // Cmd is a command from a config file.
 type Cmd struct {
+	// Name is optional and unique among the cmds of a config.
+	Name  string
 	Terms []string
 	// Milliseconds
 	DelayToKill int
-	FatalIfErr  bool
+	// KillSignal is the signal sent to the command to stop it,
+	// before it's killed after DelayToKill.
+	KillSignal syscall.Signal
+	FatalIfErr bool
+	// Milliseconds. If 0, the command has no timeout.
+	Timeout int
+	// Retries is the number of times the command is run again if it fails.
+	Retries int
+	// Milliseconds to wait before the first retry.
+	RetryDelay int
+	// RetryBackoff is the factor by which the time to wait is
+	// multiplied after each retry.
+	RetryBackoff float64
+	// RunOnStart is whether the command runs at startup,
+	// before any change happens.
+	RunOnStart bool
+	// OnChange is what happens when a change happens
+	// while the command is running.
+	OnChange OnChange
+	// Inputs are the files whose content determines whether the command
+	// needs to run. If nil, the command always runs.
+	Inputs []*regexp.Regexp
+	// Outputs are the files that the command is expected to create.
+	Outputs []*regexp.Regexp
+	// Env are the environment variables, in the KEY=VALUE format, set for
+	// the command in addition to the ones of the current process.
+	Env []string
+	// Dir is the directory in which the command runs. If empty, it
+	// runs in the current directory.
+	Dir string
+	// Stdin is whether the standard input of the current
+	// process is connected to the command.
+	Stdin bool
+	// When are the conditions for the command to run.
+	When When
+}
+
+// OnChange is what happens when a change happens while a command is running.
+type OnChange string
+
+// OnChange policies.
+const (
+	// OnChangeRestart stops the command and runs the commands again.
+	OnChangeRestart OnChange = "restart"
+	// OnChangeQueue lets the commands finish and then runs them again once.
+	OnChangeQueue OnChange = "queue"
+	// OnChangeIgnore discards the change.
+	OnChangeIgnore OnChange = "ignore"
+)
+
+// parseOnChange returns the OnChange policy named str, or OnChangeRestart if
+// str is empty, and whether str is a valid policy.
+func parseOnChange(str string) (OnChange, bool) {
+	switch onChange := OnChange(str); onChange {
+	case "":
+		return OnChangeRestart, true
+	case OnChangeRestart, OnChangeQueue, OnChangeIgnore:
+		return onChange, true
+	default:
+		return "", false
+	}
+}
+
+// When are the conditions for a command to run.
+type When struct {
+	// Changed, if not nil, restricts the command to the runs in which
+	// a path that matches at least one of them has changed.
+	Changed []*regexp.Regexp
+	// Status is the status of the previous commands required
+	// for the command to run.
+	Status Status
 }
 
+// Status is a condition on the status of the commands
+// that run before a command.
+type Status string
+
+// Statuses.
+const (
+	// StatusDefault runs the command unless the remaining commands
+	// are skipped due to fatalIfErr.
+	StatusDefault Status = ""
+	// StatusOnSuccess runs the command only if none
+	// of the previous commands failed.
+	StatusOnSuccess Status = "onSuccess"
+	// StatusOnFailure runs the command only if any of the
+	// previous commands failed, even if the remaining commands
+	// are skipped due to fatalIfErr.
+	StatusOnFailure Status = "onFailure"
+	// StatusAlways runs the command regardless of the
+	// status of the previous commands.
+	StatusAlways Status = "always"
+)
+
 // Config is the data from a config file.
 type Config struct {
+	// Root is the absolute path of the directory to be watched.
+	Root          string
 	Cmds          []Cmd
 	IgnoreRegExps []*regexp.Regexp
+	// IncludeRegExps, if not nil, restricts the events that trigger
+	// the cmds to the ones whose paths match at least one of them.
+	IncludeRegExps []*regexp.Regexp
+	// SkipUnchangedWrites is whether writes that don't change a file's content are ignored.
+	SkipUnchangedWrites bool
+	// HashSizeLimit is the size in bytes above which files are compared by
+	// size and modification time.
+	HashSizeLimit int64
+	// Snapshot is whether changes made while wrun wasn't running are reported
+	// when it starts.
+	Snapshot bool
+	// Milliseconds
+	RenameWindow int
+	// SplitRenames is whether items moved into or out of the watched directory
+	// are reported as created or deleted.
+	SplitRenames bool
+	// PollFallback is whether directories that can't be watched because the
+	// inotify watch limit has been reached are polled.
+	PollFallback bool
+	// Milliseconds
+	PollInterval int
 }
 
-// GetConfig returns the data from the config file.
-func GetConfig(configFilePath string) (*Config, error) {
-	configFile, err := getConfigFile(configFilePath)
+// GetConfig returns the data from the config file. If profileName isn't
+// empty, the profile with this name is applied to it. If its content is
+// invalid, the error is a ValidationErrors with all the errors found.
+func GetConfig(configFilePath, profileName string) (*Config, error) {
+	filePath, err := FindConfigFile(configFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	var cf configFileData
+	l := newLoader()
 
-	yamlDec := yaml.NewDecoder(configFile)
-
-	err = yamlDec.Decode(&cf)
+	root, err := l.loadWithLocal(filePath)
 	if err != nil {
+		if errs, ok := err.(ValidationErrors); ok {
+			errs.sort()
+		}
+
 		return nil, err
 	}
 
-	c, err := parseConfigFile(cf)
+	if profileName != "" {
+		root, err = l.applyProfile(root, profileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cf, errs := validate(root)
+
+	c, err := parseConfigFile(*cf)
 	if err != nil {
-		return nil, err
+		parseErrs, ok := err.(ValidationErrors)
+		if !ok {
+			return nil, err
+		}
+
+		for _, e := range parseErrs {
+			if !errs.hasPath(e.Path) {
+				errs = append(errs, e)
+			}
+		}
+	}
+
+	rootPath, err := resolveRoot(filePath, cf.Root)
+	if err != nil && !errs.hasPath("root") {
+		errs = append(errs, &ValidationError{
+			Path: "root",
+			Msg:  err.Error(),
+		})
 	}
 
+	if len(errs) > 0 {
+		errs.locate(root)
+		errs.setFiles(l.origins, filePath)
+		errs.sort()
+
+		return nil, errs
+	}
+
+	c.Root = rootPath
+
 	return c, nil
 }
 
-// CreateConfigFile creates a config file in the current directory with default data.
-func CreateConfigFile() error {
+// SelectCmds keeps only the cmds with the given names, in their original order.
+func (c *Config) SelectCmds(names []string) error {
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = false
+	}
+
+	var cmds []Cmd
+	for _, cmd := range c.Cmds {
+		if _, ok := selected[cmd.Name]; ok && cmd.Name != "" {
+			selected[cmd.Name] = true
+			cmds = append(cmds, cmd)
+		}
+	}
+
+	for _, name := range names {
+		if !selected[name] {
+			return fmt.Errorf("there's no cmd named %v", name)
+		}
+	}
+
+	c.Cmds = cmds
+
+	return nil
+}
+
+// resolveRoot returns the absolute path of the directory to be watched. If rootPath
+// is empty, it's the directory of the config file. Otherwise, it's rootPath, which
+// is relative to the directory of the config file.
+func resolveRoot(configFilePath, rootPath string) (string, error) {
+	configFileAbsPath, err := filepath.Abs(configFilePath)
+	if err != nil {
+		return "", err
+	}
+
+	configDirPath := filepath.Dir(configFileAbsPath)
+	if rootPath == "" {
+		return configDirPath, nil
+	}
+
+	if !filepath.IsAbs(rootPath) {
+		rootPath = filepath.Join(configDirPath, rootPath)
+	}
+
+	if err := CheckRoot(rootPath); err != nil {
+		return "", err
+	}
+
+	return rootPath, nil
+}
+
+// CheckRoot returns an error if rootPath isn't a directory.
+func CheckRoot(rootPath string) error {
+	info, err := os.Stat(rootPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%v doesn't exist", rootPath)
+		}
+
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("%v isn't a directory", rootPath)
+	}
+
+	return nil
+}
+
+// CreateConfigFile creates a config file in the current directory. If templateName
+// isn't empty, the file's content is the template's. Otherwise, it's the default data.
+func CreateConfigFile(templateName string) error {
 	if hasConfigFile() {
 		return errors.New("there's already a config file")
 	}
 
+	var content []byte
+	if templateName != "" {
+		var err error
+
+		content, err = getTemplate(templateName)
+		if err != nil {
+			return err
+		}
+	}
+
 	file, err := os.OpenFile(
 		defaultConfigFilePaths[0],
 		os.O_CREATE|os.O_EXCL|os.O_WRONLY,
@@ -85,6 +418,13 @@ func CreateConfigFile() error {
 	if err != nil {
 		return err
 	}
+	defer file.Close()
+
+	if content != nil {
+		_, err = file.Write(content)
+
+		return err
+	}
 
 	cmdDefaultFatalIfErr := false
 	cf := configFileData{
@@ -99,6 +439,7 @@ func CreateConfigFile() error {
 	}
 
 	enc := yaml.NewEncoder(file)
+	enc.SetIndent(2)
 	if err = enc.Encode(cf); err != nil {
 		return err
 	}
@@ -106,70 +447,208 @@ func CreateConfigFile() error {
 	return nil
 }
 
-func getConfigFile(configFilePath string) (*os.File, error) {
+// FindConfigFile returns the path of the config file to be used.
+// If configFilePath isn't empty, it's returned as long as the file exists.
+// Otherwise, the config file is looked for in the current directory and then
+// in its parents, up to the root of a repository or the home directory.
+func FindConfigFile(configFilePath string) (string, error) {
 	if configFilePath != "" {
-		f, err := os.Open(configFilePath)
-		if err != nil {
+		if _, err := os.Stat(configFilePath); err != nil {
 			if os.IsNotExist(err) {
-				return nil, errors.New("file doesn't exist")
+				return "", errors.New("file doesn't exist")
 			}
 
-			return nil, err
+			return "", err
 		}
 
-		return f, nil
+		return configFilePath, nil
 	}
 
-	for _, filePath := range defaultConfigFilePaths {
-		f, err := os.Open(filePath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	homeDirPath, _ := os.UserHomeDir()
+
+	for dirPath := wd; ; dirPath = filepath.Dir(dirPath) {
+		for _, fileName := range defaultConfigFilePaths {
+			filePath := filepath.Join(dirPath, fileName)
+
+			if _, err := os.Stat(filePath); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+
+				return "", err
 			}
 
-			return nil, err
+			// paths in the current directory are kept relative
+			if dirPath == wd {
+				return fileName, nil
+			}
+
+			return filePath, nil
+		}
+
+		if dirPath == homeDirPath || isRepoRoot(dirPath) || dirPath == filepath.Dir(dirPath) {
+			break
 		}
+	}
 
-		return f, nil
+	return "", errors.New("not found")
+}
+
+// isRepoRoot returns whether dirPath is the root of a repository.
+func isRepoRoot(dirPath string) bool {
+	for _, name := range vcsDirNames {
+		if _, err := os.Stat(filepath.Join(dirPath, name)); err == nil {
+			return true
+		}
 	}
 
-	return nil, errors.New("not found")
+	return false
 }
 
 // parseConfigFile transforms a configFile to a config.
-// Note that this function doesn't perform any kind of validation
-// on the configFile.
+// Environment variables in terms, env, dir and patterns are interpolated.
+// If cf is invalid, the error is a ValidationErrors with
+// all the errors found, without their positions.
 func parseConfigFile(cf configFileData) (*Config, error) {
+	var errs ValidationErrors
+	newErr := func(path, format string, a ...interface{}) {
+		errs = append(errs, &ValidationError{
+			Path: path,
+			Msg:  fmt.Sprintf(format, a...),
+		})
+	}
+
+	// expand interpolates str, whose path is path, using lookup.
+	// If it can't be interpolated, the error is reported and ok is false.
+	expand := func(path, str string, lookup func(string) (string, bool)) (res string, ok bool) {
+		res, err := interpolate(str, lookup)
+		if err != nil {
+			newErr(path, "%v", err)
+
+			return "", false
+		}
+
+		return res, true
+	}
+
 	if cf.Cmds == nil {
-		return nil, errors.New("missing cmds field")
+		newErr("cmds", "missing field")
+	} else if len(cf.Cmds) == 0 {
+		newErr("cmds", "cannot be empty")
 	}
 
-	if len(cf.Cmds) == 0 {
-		return nil, errors.New("cmds field is empty")
+	if cf.HashSizeLimit < 0 {
+		newErr("hashSizeLimit", "cannot be negative")
 	}
 
-	for i, cfCmd := range cf.Cmds {
-		if cfCmd.Terms == nil {
-			return nil, fmt.Errorf("missing terms field in cmds[%v]", i)
+	renameWindow := defaultRenameWindow
+	if cf.RenameWindow != nil {
+		if *cf.RenameWindow <= 0 {
+			newErr("renameWindow", "must be greater than 0")
 		}
 
-		if len(cfCmd.Terms) == 0 {
-			return nil, fmt.Errorf("terms field in cmds[%v] is empty", i)
+		renameWindow = *cf.RenameWindow
+	}
+
+	pollInterval := defaultPollInterval
+	if cf.PollInterval != nil {
+		if *cf.PollInterval <= 0 {
+			newErr("pollInterval", "must be greater than 0")
 		}
+
+		pollInterval = *cf.PollInterval
 	}
 
 	globalDelayToKill := defaultDelayToKill
 	if cf.DelayToKill != nil {
+		if *cf.DelayToKill < 0 {
+			newErr("delayToKill", "cannot be negative")
+		}
+
 		globalDelayToKill = *cf.DelayToKill
 	}
 
 	globalFatalIfErr := cf.FatalIfErr
 
+	globalTimeout := 0
+	if cf.Timeout != nil {
+		if *cf.Timeout < 0 {
+			newErr("timeout", "cannot be negative")
+		}
+
+		globalTimeout = *cf.Timeout
+	}
+
+	globalRetries := 0
+	if cf.Retries != nil {
+		if *cf.Retries < 0 {
+			newErr("retries", "cannot be negative")
+		}
+
+		globalRetries = *cf.Retries
+	}
+
+	globalRetryDelay := defaultRetryDelay
+	if cf.RetryDelay != nil {
+		if *cf.RetryDelay < 0 {
+			newErr("retryDelay", "cannot be negative")
+		}
+
+		globalRetryDelay = *cf.RetryDelay
+	}
+
+	globalRunOnStart := true
+	if cf.RunOnStart != nil {
+		globalRunOnStart = *cf.RunOnStart
+	}
+
+	globalOnChange, ok := parseOnChange(cf.OnChange)
+	if !ok {
+		newErr("onChange", "must be one of restart, queue, ignore")
+	}
+
+	globalRetryBackoff := defaultRetryBackoff
+	if cf.RetryBackoff != nil {
+		if *cf.RetryBackoff < 1 {
+			newErr("retryBackoff", "must be greater than or equal to 1")
+		}
+
+		globalRetryBackoff = *cf.RetryBackoff
+	}
+
 	cmds := make([]Cmd, 0, len(cf.Cmds))
+	cmdIndexesByName := make(map[string]int)
+
+	for i, configCmd := range cf.Cmds {
+		cmdPath := fmt.Sprintf("cmds[%v]", i)
+
+		if configCmd.Name != "" {
+			if j, ok := cmdIndexesByName[configCmd.Name]; ok {
+				newErr(cmdPath+".name", "%v is already the name of cmds[%v]", configCmd.Name, j)
+			} else if strings.Contains(configCmd.Name, ",") {
+				newErr(cmdPath+".name", "cannot contain commas")
+			}
+
+			cmdIndexesByName[configCmd.Name] = i
+		}
+
+		if configCmd.Terms == nil {
+			newErr(cmdPath+".terms", "missing field")
+		} else if len(configCmd.Terms) == 0 {
+			newErr(cmdPath+".terms", "cannot be empty")
+		}
 
-	for _, configCmd := range cf.Cmds {
 		delayToKill := globalDelayToKill
 		if configCmd.DelayToKill != nil {
+			if *configCmd.DelayToKill < 0 {
+				newErr(cmdPath+".delayToKill", "cannot be negative")
+			}
+
 			delayToKill = *configCmd.DelayToKill
 		}
 
@@ -178,46 +657,342 @@ func parseConfigFile(cf configFileData) (*Config, error) {
 			fatalIfErr = *configCmd.FatalIfErr
 		}
 
-		var terms []string
+		timeout := globalTimeout
+		if configCmd.Timeout != nil {
+			if *configCmd.Timeout < 0 {
+				newErr(cmdPath+".timeout", "cannot be negative")
+			}
+
+			timeout = *configCmd.Timeout
+		}
+
+		retries := globalRetries
+		if configCmd.Retries != nil {
+			if *configCmd.Retries < 0 {
+				newErr(cmdPath+".retries", "cannot be negative")
+			}
+
+			retries = *configCmd.Retries
+		}
+
+		retryDelay := globalRetryDelay
+		if configCmd.RetryDelay != nil {
+			if *configCmd.RetryDelay < 0 {
+				newErr(cmdPath+".retryDelay", "cannot be negative")
+			}
+
+			retryDelay = *configCmd.RetryDelay
+		}
+
+		runOnStart := globalRunOnStart
+		if configCmd.RunOnStart != nil {
+			runOnStart = *configCmd.RunOnStart
+		}
+
+		onChange := globalOnChange
+		if configCmd.OnChange != "" {
+			if onChange, ok = parseOnChange(configCmd.OnChange); !ok {
+				newErr(cmdPath+".onChange", "must be one of restart, queue, ignore")
+			}
+		}
+
+		retryBackoff := globalRetryBackoff
+		if configCmd.RetryBackoff != nil {
+			if *configCmd.RetryBackoff < 1 {
+				newErr(cmdPath+".retryBackoff", "must be greater than or equal to 1")
+			}
+
+			retryBackoff = *configCmd.RetryBackoff
+		}
+
+		// the cmd's own env vars take precedence over the process' ones
+		// and can be used in its terms, dir and patterns
+		cmdEnv := make(map[string]string)
+		lookup := func(name string) (string, bool) {
+			if value, ok := cmdEnv[name]; ok {
+				return value, true
+			}
+
+			return os.LookupEnv(name)
+		}
+
+		var env []string
+
+		for j, envVar := range configCmd.Env {
+			envVarPath := fmt.Sprintf("%v.env[%v]", cmdPath, j)
+
+			eqIndex := strings.Index(envVar, "=")
+			if eqIndex <= 0 {
+				newErr(envVarPath, "must be in the KEY=VALUE format")
+
+				continue
+			}
+
+			name := envVar[:eqIndex]
+			value, ok := expand(envVarPath, envVar[eqIndex+1:], lookup)
+			if !ok {
+				continue
+			}
+
+			cmdEnv[name] = value
+			env = append(env, name+"="+value)
+		}
+
+		terms := make([]string, 0, len(configCmd.Terms))
+		for j, term := range configCmd.Terms {
+			if term, ok := expand(fmt.Sprintf("%v.terms[%v]", cmdPath, j), term, lookup); ok {
+				terms = append(terms, term)
+			}
+		}
+
+		dir, _ := expand(cmdPath+".dir", configCmd.Dir, lookup)
+
+		var inputs, outputs []*regexp.Regexp
+
+		for j, pattern := range configCmd.Inputs {
+			patternPath := fmt.Sprintf("%v.inputs[%v]", cmdPath, j)
 
-		if configCmd.Terms != nil {
-			terms = configCmd.Terms
-		} else {
-			terms = make([]string, 0)
+			pattern, ok := expand(patternPath, pattern, lookup)
+			if !ok {
+				continue
+			}
+
+			rx, err := glob.Compile(pattern)
+			if err != nil {
+				newErr(patternPath, "%v", err)
+
+				continue
+			}
+
+			inputs = append(inputs, rx)
+		}
+
+		for j, pattern := range configCmd.Outputs {
+			patternPath := fmt.Sprintf("%v.outputs[%v]", cmdPath, j)
+
+			pattern, ok := expand(patternPath, pattern, lookup)
+			if !ok {
+				continue
+			}
+
+			rx, err := glob.Compile(pattern)
+			if err != nil {
+				newErr(patternPath, "%v", err)
+
+				continue
+			}
+
+			outputs = append(outputs, rx)
+		}
+
+		var when When
+
+		if configCmd.When != nil {
+			for j, pattern := range configCmd.When.Changed {
+				patternPath := fmt.Sprintf("%v.when.changed[%v]", cmdPath, j)
+
+				pattern, ok := expand(patternPath, pattern, lookup)
+				if !ok {
+					continue
+				}
+
+				rx, err := glob.Compile(pattern)
+				if err != nil {
+					newErr(patternPath, "%v", err)
+
+					continue
+				}
+
+				when.Changed = append(when.Changed, rx)
+			}
+
+			switch status := Status(configCmd.When.Status); status {
+			case StatusDefault, StatusOnSuccess, StatusOnFailure, StatusAlways:
+				when.Status = status
+			default:
+				newErr(cmdPath+".when.status", "must be one of onSuccess, onFailure, always")
+			}
 		}
 
 		cmds = append(cmds, Cmd{
-			Terms:       terms,
-			DelayToKill: delayToKill,
-			FatalIfErr:  fatalIfErr,
+			Name:         configCmd.Name,
+			Terms:        terms,
+			DelayToKill:  delayToKill,
+			KillSignal:   defaultKillSignal,
+			FatalIfErr:   fatalIfErr,
+			Timeout:      timeout,
+			Retries:      retries,
+			RetryDelay:   retryDelay,
+			RetryBackoff: retryBackoff,
+			RunOnStart:   runOnStart,
+			OnChange:     onChange,
+			When:         when,
+			Inputs:       inputs,
+			Outputs:      outputs,
+			Env:          env,
+			Dir:          dir,
+			Stdin:        configCmd.Stdin,
 		})
 	}
 
 	ignoreRegExps := alwaysIgnoreRegExps
-	if cf.IgnoreRegExps != nil {
-		for _, rxStr := range cf.IgnoreRegExps {
-			rx, err := regexp.Compile(rxStr)
-			if err != nil {
-				return nil, fmt.Errorf("%v regexp is invalid", rxStr)
-			}
+	for i, rxStr := range cf.IgnoreRegExps {
+		rxPath := fmt.Sprintf("ignoreRegExps[%v]", i)
+
+		rxStr, ok := expand(rxPath, rxStr, os.LookupEnv)
+		if !ok {
+			continue
+		}
+
+		rx, err := regexp.Compile(rxStr)
+		if err != nil {
+			newErr(rxPath, "%v", err)
 
-			ignoreRegExps = append(ignoreRegExps, rx)
+			continue
 		}
+
+		ignoreRegExps = append(ignoreRegExps, rx)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
 	return &Config{
-		IgnoreRegExps: ignoreRegExps,
-		Cmds:          cmds,
+		IgnoreRegExps:       ignoreRegExps,
+		Cmds:                cmds,
+		SkipUnchangedWrites: cf.SkipUnchangedWrites,
+		HashSizeLimit:       cf.HashSizeLimit,
+		Snapshot:            cf.Snapshot,
+		RenameWindow:        renameWindow,
+		SplitRenames:        cf.SplitRenames,
+		PollFallback:        cf.PollFallback,
+		PollInterval:        pollInterval,
 	}, nil
 }
 
-func hasConfigFile() bool {
-	if _, err := os.Stat("wrun.yml"); err == nil {
-		return true
+// AdHocOptions are the options of a config that isn't read from a config file.
+type AdHocOptions struct {
+	Terms []string
+	// Include are glob patterns for the paths whose changes trigger the cmd.
+	// If empty, every path that isn't ignored triggers it.
+	Include []string
+	// Ignore are glob patterns for the paths to be ignored. A directory that
+	// matches one of them is ignored along with everything inside it.
+	Ignore []string
+	// Milliseconds. If nil, the default is used.
+	DelayToKill *int
+	// KillSignal is a signal name, with or without the SIG prefix, or number.
+	// If empty, SIGINT is used.
+	KillSignal string
+}
+
+// NewAdHocConfig returns a config with a single cmd built from opts.
+func NewAdHocConfig(opts AdHocOptions) (*Config, error) {
+	if len(opts.Terms) == 0 {
+		return nil, errors.New("missing terms")
 	}
 
-	if _, err := os.Stat("wrun.yaml"); err == nil {
-		return true
+	delayToKill := defaultDelayToKill
+	if opts.DelayToKill != nil {
+		if *opts.DelayToKill < 0 {
+			return nil, errors.New("delay cannot be negative")
+		}
+
+		delayToKill = *opts.DelayToKill
+	}
+
+	killSignal := defaultKillSignal
+	if opts.KillSignal != "" {
+		var err error
+
+		killSignal, err = parseSignal(opts.KillSignal)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var includeRegExps []*regexp.Regexp
+	if len(opts.Include) > 0 {
+		var err error
+
+		includeRegExps, err = glob.CompileAll(opts.Include)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ignoreRegExps := alwaysIgnoreRegExps
+	for _, pattern := range opts.Ignore {
+		rx, err := glob.Compile(strings.TrimSuffix(pattern, "/**") + "/**")
+		if err != nil {
+			return nil, err
+		}
+
+		ignoreRegExps = append(ignoreRegExps, rx)
+	}
+
+	rootPath, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		Root: rootPath,
+		Cmds: []Cmd{
+			Cmd{
+				Terms:        opts.Terms,
+				DelayToKill:  delayToKill,
+				KillSignal:   killSignal,
+				RetryDelay:   defaultRetryDelay,
+				RetryBackoff: defaultRetryBackoff,
+				RunOnStart:   true,
+				OnChange:     OnChangeRestart,
+			},
+		},
+		IgnoreRegExps:  ignoreRegExps,
+		IncludeRegExps: includeRegExps,
+		RenameWindow:   defaultRenameWindow,
+		PollInterval:   defaultPollInterval,
+	}, nil
+}
+
+// parseSignal returns the signal named str, which can be a signal
+// name, with or without the SIG prefix, or number.
+func parseSignal(str string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(str); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+
+	name := strings.ToUpper(str)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	if sig := unix.SignalNum(name); sig != 0 {
+		return sig, nil
+	}
+
+	return 0, fmt.Errorf("%v signal is invalid", str)
+}
+
+// IsBuiltinIgnoreRegExp returns whether rx is one of the regexps that are always
+// part of Config.IgnoreRegExps, regardless of the config file.
+func IsBuiltinIgnoreRegExp(rx *regexp.Regexp) bool {
+	for _, builtinRx := range alwaysIgnoreRegExps {
+		if rx == builtinRx {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasConfigFile() bool {
+	for _, filePath := range defaultConfigFilePaths {
+		if _, err := os.Stat(filePath); err == nil {
+			return true
+		}
 	}
 
 	return false
@@ -1,18 +1,30 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
+
+	"github.com/efreitasn/wrun/v4/internal/glob"
 )
 
 func TestParseConfigFile(t *testing.T) {
 	delay0 := 0
 	delay700 := 700
 	delay900 := 900
+	renameWindow50 := 50
+	pollInterval500 := 500
+	retries0 := 0
+	retries3 := 3
+	backoff1 := 1.0
 	boolFalse := false
+	boolTrue := true
 
 	tests := []struct {
 		cf  configFileData
@@ -31,12 +43,19 @@ func TestParseConfigFile(t *testing.T) {
 				},
 			},
 			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
 				IgnoreRegExps: append(alwaysIgnoreRegExps, regexp.MustCompile("aa.*")),
 				Cmds: []Cmd{
 					Cmd{
-						Terms:       []string{"foo", "bar"},
-						DelayToKill: delay700,
-						FatalIfErr:  true,
+						Terms:        []string{"foo", "bar"},
+						DelayToKill:  delay700,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   true,
 					},
 				},
 			},
@@ -53,12 +72,19 @@ func TestParseConfigFile(t *testing.T) {
 				},
 			},
 			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
 				IgnoreRegExps: alwaysIgnoreRegExps,
 				Cmds: []Cmd{
 					Cmd{
-						Terms:       []string{"echo", "a"},
-						DelayToKill: delay700,
-						FatalIfErr:  true,
+						Terms:        []string{"echo", "a"},
+						DelayToKill:  delay700,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   true,
 					},
 				},
 			},
@@ -80,17 +106,29 @@ func TestParseConfigFile(t *testing.T) {
 				},
 			},
 			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
 				IgnoreRegExps: alwaysIgnoreRegExps,
 				Cmds: []Cmd{
 					Cmd{
-						Terms:       []string{"foo", "bar"},
-						DelayToKill: delay700,
-						FatalIfErr:  boolFalse,
+						Terms:        []string{"foo", "bar"},
+						DelayToKill:  delay700,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   boolFalse,
 					},
 					Cmd{
-						Terms:       []string{"bar", "foo"},
-						DelayToKill: delay900,
-						FatalIfErr:  true,
+						Terms:        []string{"bar", "foo"},
+						DelayToKill:  delay900,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   true,
 					},
 				},
 			},
@@ -113,17 +151,29 @@ func TestParseConfigFile(t *testing.T) {
 				},
 			},
 			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
 				IgnoreRegExps: alwaysIgnoreRegExps,
 				Cmds: []Cmd{
 					Cmd{
-						Terms:       []string{"foo", "bar"},
-						DelayToKill: delay700,
-						FatalIfErr:  boolFalse,
+						Terms:        []string{"foo", "bar"},
+						DelayToKill:  delay700,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   boolFalse,
 					},
 					Cmd{
-						Terms:       []string{"bar", "foo"},
-						DelayToKill: delay0,
-						FatalIfErr:  true,
+						Terms:        []string{"bar", "foo"},
+						DelayToKill:  delay0,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   true,
 					},
 				},
 			},
@@ -143,17 +193,305 @@ func TestParseConfigFile(t *testing.T) {
 				},
 			},
 			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
 				IgnoreRegExps: alwaysIgnoreRegExps,
 				Cmds: []Cmd{
 					Cmd{
-						Terms:       []string{"foo", "bar"},
-						DelayToKill: defaultDelayToKill,
-						FatalIfErr:  boolFalse,
+						Terms:        []string{"foo", "bar"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   boolFalse,
 					},
 					Cmd{
-						Terms:       []string{"bar", "foo"},
-						DelayToKill: defaultDelayToKill,
-						FatalIfErr:  true,
+						Terms:        []string{"bar", "foo"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						FatalIfErr:   true,
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				SkipUnchangedWrites: true,
+				HashSizeLimit:       1024,
+				Snapshot:            true,
+				RenameWindow:        &renameWindow50,
+				SplitRenames:        true,
+				PollFallback:        true,
+				PollInterval:        &pollInterval500,
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms: []string{"foo"},
+					},
+				},
+			},
+			Config{
+				IgnoreRegExps:       alwaysIgnoreRegExps,
+				SkipUnchangedWrites: true,
+				HashSizeLimit:       1024,
+				Snapshot:            true,
+				RenameWindow:        renameWindow50,
+				SplitRenames:        true,
+				PollFallback:        true,
+				PollInterval:        pollInterval500,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"foo"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms:   []string{"go", "build"},
+						Inputs:  []string{"**/*.go", "go.mod"},
+						Outputs: []string{"bin/*"},
+					},
+				},
+			},
+			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
+				IgnoreRegExps: alwaysIgnoreRegExps,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"go", "build"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						Inputs: []*regexp.Regexp{
+							regexp.MustCompile(`^(?:.*/)?[^/]*\.go$`),
+							regexp.MustCompile(`^go\.mod$`),
+						},
+						Outputs: []*regexp.Regexp{
+							regexp.MustCompile(`^bin/[^/]*$`),
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				Timeout: &delay900,
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms: []string{"foo"},
+					},
+					configFileCmd{
+						Timeout: &delay0,
+						Terms:   []string{"bar"},
+					},
+				},
+			},
+			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
+				IgnoreRegExps: alwaysIgnoreRegExps,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"foo"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						Timeout:      delay900,
+					},
+					Cmd{
+						Terms:        []string{"bar"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				Retries:      &retries3,
+				RetryBackoff: &backoff1,
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms: []string{"foo"},
+					},
+					configFileCmd{
+						Retries:    &retries0,
+						RetryDelay: &delay900,
+						Terms:      []string{"bar"},
+					},
+				},
+			},
+			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
+				IgnoreRegExps: alwaysIgnoreRegExps,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"foo"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						Retries:      retries3,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: backoff1,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+					},
+					Cmd{
+						Terms:        []string{"bar"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   delay900,
+						RetryBackoff: backoff1,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms: []string{"go", "mod", "download"},
+						When: &configFileWhen{
+							Changed: []string{"go.mod"},
+						},
+					},
+					configFileCmd{
+						Terms: []string{"notify"},
+						When: &configFileWhen{
+							Status: "onFailure",
+						},
+					},
+				},
+			},
+			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
+				IgnoreRegExps: alwaysIgnoreRegExps,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"go", "mod", "download"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						When: When{
+							Changed: []*regexp.Regexp{regexp.MustCompile(`^go\.mod$`)},
+						},
+					},
+					Cmd{
+						Terms:        []string{"notify"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						When: When{
+							Status: StatusOnFailure,
+						},
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				RunOnStart: &boolFalse,
+				OnChange:   "ignore",
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms: []string{"foo"},
+					},
+					configFileCmd{
+						RunOnStart: &boolTrue,
+						OnChange:   "queue",
+						Terms:      []string{"bar"},
+					},
+				},
+			},
+			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
+				IgnoreRegExps: alwaysIgnoreRegExps,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"foo"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeIgnore,
+					},
+					Cmd{
+						Terms:        []string{"bar"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeQueue,
+						RunOnStart:   true,
+					},
+				},
+			},
+			nil,
+		},
+		{
+			configFileData{
+				Cmds: []configFileCmd{
+					configFileCmd{
+						Terms: []string{"foo"},
+						Stdin: true,
+					},
+				},
+			},
+			Config{
+				RenameWindow:  defaultRenameWindow,
+				PollInterval:  defaultPollInterval,
+				IgnoreRegExps: alwaysIgnoreRegExps,
+				Cmds: []Cmd{
+					Cmd{
+						Terms:        []string{"foo"},
+						DelayToKill:  defaultDelayToKill,
+						KillSignal:   syscall.SIGINT,
+						RetryDelay:   defaultRetryDelay,
+						RetryBackoff: defaultRetryBackoff,
+						OnChange:     OnChangeRestart,
+						RunOnStart:   true,
+						Stdin:        true,
 					},
 				},
 			},
@@ -173,6 +511,34 @@ func TestParseConfigFile(t *testing.T) {
 				t.Errorf("got %v, want %v", res.Cmds, test.res.Cmds)
 			}
 
+			if res.SkipUnchangedWrites != test.res.SkipUnchangedWrites {
+				t.Errorf("got %v, want %v", res.SkipUnchangedWrites, test.res.SkipUnchangedWrites)
+			}
+
+			if res.HashSizeLimit != test.res.HashSizeLimit {
+				t.Errorf("got %v, want %v", res.HashSizeLimit, test.res.HashSizeLimit)
+			}
+
+			if res.Snapshot != test.res.Snapshot {
+				t.Errorf("got %v, want %v", res.Snapshot, test.res.Snapshot)
+			}
+
+			if res.RenameWindow != test.res.RenameWindow {
+				t.Errorf("got %v, want %v", res.RenameWindow, test.res.RenameWindow)
+			}
+
+			if res.SplitRenames != test.res.SplitRenames {
+				t.Errorf("got %v, want %v", res.SplitRenames, test.res.SplitRenames)
+			}
+
+			if res.PollFallback != test.res.PollFallback {
+				t.Errorf("got %v, want %v", res.PollFallback, test.res.PollFallback)
+			}
+
+			if res.PollInterval != test.res.PollInterval {
+				t.Errorf("got %v, want %v", res.PollInterval, test.res.PollInterval)
+			}
+
 			resRegExpsStr := make([]string, 0)
 			expectedRegExpsStr := make([]string, 0)
 
@@ -195,6 +561,74 @@ func TestParseConfigFile(t *testing.T) {
 	}
 }
 
+func TestParseConfigFile_interpolation(t *testing.T) {
+	os.Setenv("WRUN_TEST_PKG", "./pkg/...")
+	os.Unsetenv("WRUN_TEST_UNSET")
+	defer os.Unsetenv("WRUN_TEST_PKG")
+
+	cf := configFileData{
+		IgnoreRegExps: []string{"^${WRUN_TEST_UNSET:-tmp}/$"},
+		Cmds: []configFileCmd{
+			configFileCmd{
+				Env:    []string{"PORT=${WRUN_TEST_UNSET:-8080}", "ADDR=:$PORT"},
+				Terms:  []string{"go", "test", "$WRUN_TEST_PKG", "$$ADDR", "${ADDR}"},
+				Dir:    "${WRUN_TEST_UNSET-sub}",
+				Inputs: []string{"${WRUN_TEST_UNSET:-**/*.go}"},
+			},
+		},
+	}
+
+	c, err := parseConfigFile(cf)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	cmd := c.Cmds[0]
+
+	if want := []string{"PORT=8080", "ADDR=:8080"}; !reflect.DeepEqual(cmd.Env, want) {
+		t.Errorf("env: got %v, want %v", cmd.Env, want)
+	}
+
+	if want := []string{"go", "test", "./pkg/...", "$ADDR", ":8080"}; !reflect.DeepEqual(cmd.Terms, want) {
+		t.Errorf("terms: got %v, want %v", cmd.Terms, want)
+	}
+
+	if cmd.Dir != "sub" {
+		t.Errorf("dir: got %v, want %v", cmd.Dir, "sub")
+	}
+
+	if len(cmd.Inputs) != 1 || !cmd.Inputs[0].MatchString("a/b.go") {
+		t.Errorf("inputs: got %v, want a pattern matching a/b.go", cmd.Inputs)
+	}
+
+	if rx := c.IgnoreRegExps[len(c.IgnoreRegExps)-1]; rx.String() != "^tmp/$" {
+		t.Errorf("ignoreRegExps: got %v, want %v", rx, "^tmp/$")
+	}
+
+	cf.Cmds[0].Env = []string{"PORT"}
+	cf.Cmds[0].Terms = []string{"echo", "${WRUN_TEST_UNSET:?must be set}"}
+
+	_, err = parseConfigFile(cf)
+
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("got %v, want ValidationErrors", err)
+	}
+
+	var strs []string
+	for _, e := range errs {
+		strs = append(strs, e.Error())
+	}
+
+	want := []string{
+		"cmds[0].env[0]: must be in the KEY=VALUE format",
+		"cmds[0].terms[1]: WRUN_TEST_UNSET: must be set",
+	}
+	if !reflect.DeepEqual(strs, want) {
+		t.Errorf("got %q, want %q", strs, want)
+	}
+}
+
 func TestHasConfigFile(t *testing.T) {
 	t.Run("wrun.yaml", func(t *testing.T) {
 		_, err := os.Create("wrun.yaml")
@@ -229,3 +663,626 @@ func TestHasConfigFile(t *testing.T) {
 		}
 	})
 }
+
+func TestGetConfig_validation(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			"valid",
+			"cmds:\n  - terms: [sleep, 1]\n",
+			nil,
+		},
+		{
+			"empty",
+			"",
+			[]string{"wrun.test.yaml: cmds: missing field"},
+		},
+		{
+			"unknown fields",
+			"foo: 1\ncmds:\n  - terms: [echo]\n    bar: true\n",
+			[]string{
+				"wrun.test.yaml:1:1: foo: unknown field",
+				"wrun.test.yaml:4:5: cmds[0].bar: unknown field",
+			},
+		},
+		{
+			"types",
+			"delayToKill: abc\nfatalIfErr: 1\ncmds: {}\n",
+			[]string{
+				"wrun.test.yaml:1:14: delayToKill: must be an integer",
+				"wrun.test.yaml:2:13: fatalIfErr: must be a boolean",
+				"wrun.test.yaml:3:7: cmds: must be an array",
+			},
+		},
+		{
+			"semantic",
+			"delayToKill: -1\nignoreRegExps: [a, \"[b\"]\ncmds:\n  - terms: []\n  - delayToKill: -2\n  - terms: [echo]\n    inputs: [\"[a\"]\n",
+			[]string{
+				"wrun.test.yaml:1:14: delayToKill: cannot be negative",
+				"wrun.test.yaml:2:20: ignoreRegExps[1]: error parsing regexp: missing closing ]: `[b`",
+				"wrun.test.yaml:4:12: cmds[0].terms: cannot be empty",
+				"wrun.test.yaml:5:5: cmds[1].terms: missing field",
+				"wrun.test.yaml:5:18: cmds[1].delayToKill: cannot be negative",
+				"wrun.test.yaml:7:14: cmds[2].inputs[0]: " + globErrStr(t, "[a"),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ioutil.WriteFile("wrun.test.yaml", []byte(test.content), os.ModePerm)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.Remove("wrun.test.yaml")
+
+			_, err = GetConfig("wrun.test.yaml", "")
+			if test.expected == nil {
+				if err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+
+				return
+			}
+
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("got %T (%v), want ValidationErrors", err, err)
+			}
+
+			errsStr := make([]string, 0, len(errs))
+			for _, e := range errs {
+				errsStr = append(errsStr, e.Error())
+			}
+
+			if !reflect.DeepEqual(errsStr, test.expected) {
+				t.Errorf("got %q, want %q", errsStr, test.expected)
+			}
+		})
+	}
+}
+
+func globErrStr(t *testing.T, pattern string) string {
+	_, err := glob.Compile(pattern)
+	if err == nil {
+		t.Fatalf("expected err compiling %v", pattern)
+	}
+
+	return err.Error()
+}
+
+func TestSchema(t *testing.T) {
+	bs, err := ioutil.ReadFile("../../wrun.schema.json")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if string(bs) != string(Schema()) {
+		t.Error("wrun.schema.json is outdated, run wrun schema > wrun.schema.json")
+	}
+}
+
+func TestNewAdHocConfig(t *testing.T) {
+	delay500 := 500
+
+	c, err := NewAdHocConfig(AdHocOptions{
+		Terms:       []string{"go", "test", "./..."},
+		Include:     []string{"**/*.go"},
+		Ignore:      []string{"vendor", "tmp/**"},
+		DelayToKill: &delay500,
+		KillSignal:  "term",
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expectedCmds := []Cmd{
+		Cmd{
+			Terms:        []string{"go", "test", "./..."},
+			DelayToKill:  delay500,
+			KillSignal:   syscall.SIGTERM,
+			RetryDelay:   defaultRetryDelay,
+			RetryBackoff: defaultRetryBackoff,
+			OnChange:     OnChangeRestart,
+			RunOnStart:   true,
+		},
+	}
+	if !reflect.DeepEqual(c.Cmds, expectedCmds) {
+		t.Errorf("got %v, want %v", c.Cmds, expectedCmds)
+	}
+
+	if len(c.IncludeRegExps) != 1 || !c.IncludeRegExps[0].MatchString("a/b.go") {
+		t.Errorf("got %v, want a regexp matching a/b.go", c.IncludeRegExps)
+	}
+
+	for _, p := range []string{"vendor/", "vendor/a.go", "tmp/"} {
+		matched := false
+
+		for _, rx := range c.IgnoreRegExps {
+			if rx.MatchString(p) {
+				matched = true
+			}
+		}
+
+		if !matched {
+			t.Errorf("expected %v to be ignored", p)
+		}
+	}
+
+	invalidOpts := []AdHocOptions{
+		AdHocOptions{},
+		AdHocOptions{Terms: []string{"a"}, KillSignal: "foo"},
+		AdHocOptions{Terms: []string{"a"}, Include: []string{"[a"}},
+	}
+
+	for _, opts := range invalidOpts {
+		if _, err := NewAdHocConfig(opts); err == nil {
+			t.Errorf("expected err for %+v", opts)
+		}
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	for name, content := range templates {
+		t.Run(name, func(t *testing.T) {
+			err := ioutil.WriteFile("wrun.test.yaml", []byte(content), os.ModePerm)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.Remove("wrun.test.yaml")
+
+			if _, err := GetConfig("wrun.test.yaml", ""); err != nil {
+				t.Errorf("unexpected err: %v", err)
+			}
+		})
+	}
+}
+
+func TestDetectTemplate(t *testing.T) {
+	if name := DetectTemplate(); name != "" {
+		t.Fatalf("got %v, want none", name)
+	}
+
+	for _, fileName := range []string{"Makefile", "Cargo.toml"} {
+		if _, err := os.Create(fileName); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer os.Remove(fileName)
+	}
+
+	if name, expectedName := DetectTemplate(), "rust"; name != expectedName {
+		t.Errorf("got %v, want %v", name, expectedName)
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	if _, err := os.Create("a/wrun.yml"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if err := os.Chdir("a/b"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	t.Run("parent", func(t *testing.T) {
+		filePath, err := FindConfigFile("")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if expectedFilePath := filepath.Join(wd, "a/wrun.yml"); filePath != expectedFilePath {
+			t.Errorf("got %v, want %v", filePath, expectedFilePath)
+		}
+	})
+
+	t.Run("repo root", func(t *testing.T) {
+		if err := os.Remove("../wrun.yml"); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if _, err := os.Create(filepath.Join(wd, "wrun.yml")); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer os.Remove(filepath.Join(wd, "wrun.yml"))
+
+		if err := os.Mkdir("../.git", os.ModeDir|os.ModePerm); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if _, err := FindConfigFile(""); err == nil {
+			t.Error("expected err, got nil")
+		}
+	})
+}
+
+func TestGetConfig_root(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	tests := []struct {
+		content      string
+		expectedRoot string
+		expectedErr  bool
+	}{
+		{"cmds:\n  - terms: [a]\n", filepath.Join(wd, "a"), false},
+		{"root: b\ncmds:\n  - terms: [a]\n", filepath.Join(wd, "a/b"), false},
+		{"root: c\ncmds:\n  - terms: [a]\n", "", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := ioutil.WriteFile("a/wrun.yaml", []byte(test.content), os.ModePerm)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			c, err := GetConfig("a/wrun.yaml", "")
+			if test.expectedErr {
+				if err == nil {
+					t.Fatal("expected err, got nil")
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if c.Root != test.expectedRoot {
+				t.Errorf("got %v, want %v", c.Root, test.expectedRoot)
+			}
+		})
+	}
+}
+
+func TestGetConfig_formats(t *testing.T) {
+	tests := []struct {
+		fileName string
+		content  string
+		errs     []string
+	}{
+		{
+			"wrun.test.yaml",
+			"delayToKill: 500\nignoreRegExps: [a]\ncmds:\n  - terms: [echo, a]\n    fatalIfErr: true\n",
+			nil,
+		},
+		{
+			"wrun.test.json",
+			"{\n  \"delayToKill\": 500,\n  \"ignoreRegExps\": [\"a\"],\n  \"cmds\": [\n    {\"terms\": [\"echo\", \"a\"], \"fatalIfErr\": true}\n  ]\n}\n",
+			nil,
+		},
+		{
+			"wrun.test.toml",
+			"delayToKill = 500\nignoreRegExps = [\"a\"]\n\n[[cmds]]\nterms = [\"echo\", \"a\"]\nfatalIfErr = true\n",
+			nil,
+		},
+		{
+			"wrun.test.json",
+			"{\n  \"delayToKill\": -1,\n  \"foo\": 1,\n  \"cmds\": [\n    {\"terms\": \"echo\"}\n  ]\n}\n",
+			[]string{
+				"wrun.test.json:2:18: delayToKill: cannot be negative",
+				"wrun.test.json:3:3: foo: unknown field",
+				"wrun.test.json:5:15: cmds[0].terms: must be an array",
+			},
+		},
+		{
+			"wrun.test.toml",
+			"delayToKill = -1\nfoo = 1\n\n[[cmds]]\nterms = \"echo\"\n",
+			[]string{
+				"wrun.test.toml:1:1: delayToKill: cannot be negative",
+				"wrun.test.toml:2:1: foo: unknown field",
+				"wrun.test.toml:5:1: cmds[0].terms: must be an array",
+			},
+		},
+	}
+
+	expectedCmds := []Cmd{
+		Cmd{
+			Terms:        []string{"echo", "a"},
+			DelayToKill:  500,
+			KillSignal:   syscall.SIGINT,
+			RetryDelay:   defaultRetryDelay,
+			RetryBackoff: defaultRetryBackoff,
+			OnChange:     OnChangeRestart,
+			RunOnStart:   true,
+			FatalIfErr:   true,
+		},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			err := ioutil.WriteFile(test.fileName, []byte(test.content), os.ModePerm)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			defer os.Remove(test.fileName)
+
+			c, err := GetConfig(test.fileName, "")
+			if test.errs != nil {
+				errs, ok := err.(ValidationErrors)
+				if !ok {
+					t.Fatalf("got %T (%v), want ValidationErrors", err, err)
+				}
+
+				errsStr := make([]string, 0, len(errs))
+				for _, e := range errs {
+					errsStr = append(errsStr, e.Error())
+				}
+
+				if !reflect.DeepEqual(errsStr, test.errs) {
+					t.Errorf("got %q, want %q", errsStr, test.errs)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if !reflect.DeepEqual(c.Cmds, expectedCmds) {
+				t.Errorf("got %v, want %v", c.Cmds, expectedCmds)
+			}
+
+			if len(c.IgnoreRegExps) != len(alwaysIgnoreRegExps)+1 {
+				t.Errorf("got %v, want the built-in regexps and a", c.IgnoreRegExps)
+			}
+		})
+	}
+}
+
+func TestGetConfig_compose(t *testing.T) {
+	err := os.MkdirAll("a", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a", err)
+	}
+	defer os.RemoveAll("a")
+
+	files := map[string]string{
+		"a/base.yaml":       "delayToKill: 200\nfatalIfErr: true\nignoreRegExps: [x]\ncmds:\n  - terms: [base]\n",
+		"a/inc.toml":        "delayToKill = 999\nignoreRegExps = [\"z\"]\n\n[[cmds]]\nterms = [\"inc\"]\n",
+		"a/wrun.yaml":       "extends: base.yaml\ninclude: [inc.toml]\nignoreRegExps: [y]\ncmds:\n  - terms: [main]\n",
+		"a/wrun.local.yaml": "delayToKill: 300\n",
+		"a/c1.yaml":         "extends: c2.yaml\ncmds:\n  - terms: [a]\n",
+		"a/c2.yaml":         "extends: c1.yaml\n",
+		"a/d1.yaml":         "extends: d2.yaml\ncmds:\n  - terms: [a]\n",
+		"a/d2.yaml":         "foo: 1\n",
+	}
+
+	for filePath, content := range files {
+		if err := ioutil.WriteFile(filePath, []byte(content), os.ModePerm); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	t.Run("merge", func(t *testing.T) {
+		c, err := GetConfig("a/wrun.yaml", "")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		expectedCmds := []Cmd{
+			Cmd{
+				Terms:        []string{"main"},
+				DelayToKill:  300,
+				KillSignal:   syscall.SIGINT,
+				RetryDelay:   defaultRetryDelay,
+				RetryBackoff: defaultRetryBackoff,
+				OnChange:     OnChangeRestart,
+				RunOnStart:   true,
+				FatalIfErr:   true,
+			},
+			Cmd{
+				Terms:        []string{"inc"},
+				DelayToKill:  300,
+				KillSignal:   syscall.SIGINT,
+				RetryDelay:   defaultRetryDelay,
+				RetryBackoff: defaultRetryBackoff,
+				OnChange:     OnChangeRestart,
+				RunOnStart:   true,
+				FatalIfErr:   true,
+			},
+		}
+		if !reflect.DeepEqual(c.Cmds, expectedCmds) {
+			t.Errorf("got %v, want %v", c.Cmds, expectedCmds)
+		}
+
+		var rxsStr []string
+		for _, rx := range c.IgnoreRegExps[len(alwaysIgnoreRegExps):] {
+			rxsStr = append(rxsStr, rx.String())
+		}
+
+		if expectedRxsStr := []string{"x", "y", "z"}; !reflect.DeepEqual(rxsStr, expectedRxsStr) {
+			t.Errorf("got %v, want %v", rxsStr, expectedRxsStr)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		_, err := GetConfig("a/c1.yaml", "")
+		if err == nil || !strings.Contains(err.Error(), "cycle") {
+			t.Errorf("got %v, want a cycle error", err)
+		}
+	})
+
+	t.Run("error in extended file", func(t *testing.T) {
+		_, err := GetConfig("a/d1.yaml", "")
+
+		if expectedErr := "a/d2.yaml:1:1: foo: unknown field"; err == nil || err.Error() != expectedErr {
+			t.Errorf("got %v, want %v", err, expectedErr)
+		}
+	})
+}
+
+func TestGitIgnoreLocalConfigFiles(t *testing.T) {
+	tests := []struct {
+		name   string
+		isRepo bool
+		// gitignore and expectedGitignore are empty if there's no .gitignore.
+		gitignore         string
+		expectedAdded     bool
+		expectedGitignore string
+	}{
+		{"not a repo", false, "", false, ""},
+		{"no .gitignore", true, "", true, "wrun.local.*\n"},
+		{"without trailing newline", true, "bin", true, "bin\nwrun.local.*\n"},
+		{"already ignored", true, "bin\nwrun.local.*\n", false, "bin\nwrun.local.*\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := os.MkdirAll("a", os.ModeDir|os.ModePerm)
+			if err != nil {
+				t.Fatalf("unexpected error creating %v: %v", "a", err)
+			}
+			defer os.RemoveAll("a")
+
+			if test.isRepo {
+				if err := os.Mkdir("a/.git", os.ModePerm); err != nil {
+					t.Fatalf("unexpected error creating %v: %v", "a/.git", err)
+				}
+			}
+
+			if test.gitignore != "" {
+				if err := ioutil.WriteFile("a/.gitignore", []byte(test.gitignore), os.ModePerm); err != nil {
+					t.Fatalf("unexpected err: %v", err)
+				}
+			}
+
+			added, err := GitIgnoreLocalConfigFiles("a")
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if added != test.expectedAdded {
+				t.Errorf("got %v, want %v", added, test.expectedAdded)
+			}
+
+			content, err := ioutil.ReadFile("a/.gitignore")
+			switch {
+			case test.expectedGitignore == "":
+				if !os.IsNotExist(err) {
+					t.Errorf("got %q, %v, want no .gitignore", content, err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected err: %v", err)
+			case string(content) != test.expectedGitignore:
+				t.Errorf("got %q, want %q", content, test.expectedGitignore)
+			}
+		})
+	}
+}
+
+func TestGetConfig_profiles(t *testing.T) {
+	err := os.MkdirAll("a", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a", err)
+	}
+	defer os.RemoveAll("a")
+
+	content := `ignoreRegExps: [x]
+cmds:
+  - name: build
+    terms: [go, build]
+  - name: test
+    terms: [go, test]
+profiles:
+  ci:
+    fatalIfErr: true
+    ignoreRegExps: [y]
+    cmds:
+      - name: test
+        terms: [go, test, -race]
+      - name: lint
+        terms: [golint]
+  broken:
+    cmds:
+      - name: new
+`
+	if err := ioutil.WriteFile("a/wrun.yaml", []byte(content), os.ModePerm); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	t.Run("no profile", func(t *testing.T) {
+		c, err := GetConfig("a/wrun.yaml", "")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if len(c.Cmds) != 2 || c.Cmds[1].FatalIfErr {
+			t.Errorf("got %v, want the cmds without the profile", c.Cmds)
+		}
+	})
+
+	t.Run("profile", func(t *testing.T) {
+		c, err := GetConfig("a/wrun.yaml", "ci")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		var terms [][]string
+		for _, cmd := range c.Cmds {
+			if !cmd.FatalIfErr {
+				t.Errorf("%v: got fatalIfErr false, want true", cmd.Name)
+			}
+
+			terms = append(terms, cmd.Terms)
+		}
+
+		expectedTerms := [][]string{{"go", "build"}, {"go", "test", "-race"}, {"golint"}}
+		if !reflect.DeepEqual(terms, expectedTerms) {
+			t.Errorf("got %v, want %v", terms, expectedTerms)
+		}
+
+		if n := len(c.IgnoreRegExps) - len(alwaysIgnoreRegExps); n != 2 {
+			t.Errorf("got %v ignoreRegExps, want %v", n, 2)
+		}
+
+		if err := c.SelectCmds([]string{"lint", "build"}); err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if len(c.Cmds) != 2 || c.Cmds[0].Name != "build" || c.Cmds[1].Name != "lint" {
+			t.Errorf("got %v, want the build and lint cmds", c.Cmds)
+		}
+
+		if err := c.SelectCmds([]string{"test"}); err == nil {
+			t.Errorf("expected err selecting a cmd that isn't in the config")
+		}
+	})
+
+	t.Run("missing profile", func(t *testing.T) {
+		if _, err := GetConfig("a/wrun.yaml", "dev"); err == nil {
+			t.Errorf("expected err")
+		}
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		_, err := GetConfig("a/wrun.yaml", "broken")
+
+		if expectedErr := "a/wrun.yaml:18:9: cmds[2].terms: missing field"; err == nil || err.Error() != expectedErr {
+			t.Errorf("got %v, want %v", err, expectedErr)
+		}
+	})
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+)
+
+// format is the format of a config file.
+type format int
+
+const (
+	formatYAML format = iota
+	formatJSON
+	formatTOML
+)
+
+// formatOf returns the format of the config file at filePath based on its
+// extension. Files with an unknown extension are considered YAML.
+func formatOf(filePath string) format {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	default:
+		return formatYAML
+	}
+}
+
+// parseContent parses the content of a config file in the format f to a YAML node,
+// so that every format is validated and decoded the same way. If content is empty,
+// the node's kind is 0.
+func parseContent(content []byte, f format) (*yaml.Node, error) {
+	var root yaml.Node
+
+	if len(bytes.TrimSpace(content)) == 0 {
+		return &root, nil
+	}
+
+	switch f {
+	case formatJSON:
+		return jsonToNode(content)
+	case formatTOML:
+		tree, err := toml.LoadBytes(content)
+		if err != nil {
+			return nil, err
+		}
+
+		return tomlTreeToNode(tree), nil
+	}
+
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return nil, err
+	}
+
+	return &root, nil
+}
+
+// jsonParser converts JSON to YAML nodes, keeping the position of each value.
+type jsonParser struct {
+	data []byte
+	dec  *json.Decoder
+	// lineStarts are the offsets at which each line starts.
+	lineStarts []int
+}
+
+func jsonToNode(data []byte) (*yaml.Node, error) {
+	p := &jsonParser{
+		data:       data,
+		dec:        json.NewDecoder(bytes.NewReader(data)),
+		lineStarts: []int{0},
+	}
+	p.dec.UseNumber()
+
+	for i, b := range data {
+		if b == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+
+	node, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.dec.Token(); err != io.EOF {
+		return nil, p.errorf("unexpected data after top-level value")
+	}
+
+	return node, nil
+}
+
+// pos returns the line and column of the next token.
+func (p *jsonParser) pos() (line, column int) {
+	offset := int(p.dec.InputOffset())
+	for offset < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[offset]) != -1 {
+		offset++
+	}
+
+	line = sort.Search(len(p.lineStarts), func(i int) bool {
+		return p.lineStarts[i] > offset
+	})
+
+	return line, offset - p.lineStarts[line-1] + 1
+}
+
+func (p *jsonParser) errorf(format string, a ...interface{}) error {
+	line, column := p.pos()
+
+	return fmt.Errorf("line %v, column %v: %v", line, column, fmt.Sprintf(format, a...))
+}
+
+func (p *jsonParser) value() (*yaml.Node, error) {
+	line, column := p.pos()
+
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+
+	node := &yaml.Node{
+		Kind:   yaml.ScalarNode,
+		Line:   line,
+		Column: column,
+	}
+
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			node.Kind = yaml.MappingNode
+			node.Tag = "!!map"
+
+			for p.dec.More() {
+				keyNode, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+
+				valueNode, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+
+				node.Content = append(node.Content, keyNode, valueNode)
+			}
+		} else {
+			node.Kind = yaml.SequenceNode
+			node.Tag = "!!seq"
+
+			for p.dec.More() {
+				itemNode, err := p.value()
+				if err != nil {
+					return nil, err
+				}
+
+				node.Content = append(node.Content, itemNode)
+			}
+		}
+
+		// closing delimiter
+		if _, err := p.dec.Token(); err != nil {
+			return nil, p.errorf("%v", err)
+		}
+	case string:
+		node.Tag = "!!str"
+		node.Value = v
+	case json.Number:
+		node.Tag = "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			node.Tag = "!!float"
+		}
+		node.Value = v.String()
+	case bool:
+		node.Tag = "!!bool"
+		node.Value = strconv.FormatBool(v)
+	case nil:
+		node.Tag = "!!null"
+		node.Value = "null"
+	}
+
+	return node, nil
+}
+
+func tomlTreeToNode(tree *toml.Tree) *yaml.Node {
+	pos := tree.Position()
+	node := &yaml.Node{
+		Kind:   yaml.MappingNode,
+		Tag:    "!!map",
+		Line:   pos.Line,
+		Column: pos.Col,
+	}
+
+	// the keys are sorted by position, since they're returned in no particular order
+	keys := tree.Keys()
+	sort.Slice(keys, func(i, j int) bool {
+		posI := tree.GetPositionPath([]string{keys[i]})
+		posJ := tree.GetPositionPath([]string{keys[j]})
+
+		if posI.Line != posJ.Line {
+			return posI.Line < posJ.Line
+		}
+
+		return posI.Col < posJ.Col
+	})
+
+	for _, key := range keys {
+		keyPos := tree.GetPositionPath([]string{key})
+
+		node.Content = append(
+			node.Content,
+			&yaml.Node{
+				Kind:   yaml.ScalarNode,
+				Tag:    "!!str",
+				Value:  key,
+				Line:   keyPos.Line,
+				Column: keyPos.Col,
+			},
+			tomlValueToNode(tree.GetPath([]string{key}), keyPos),
+		)
+	}
+
+	return node
+}
+
+// tomlValueToNode converts a value from a toml.Tree to a YAML node. pos is used
+// as the position of values that don't have one, e.g. array items.
+func tomlValueToNode(value interface{}, pos toml.Position) *yaml.Node {
+	node := &yaml.Node{
+		Kind:   yaml.ScalarNode,
+		Line:   pos.Line,
+		Column: pos.Col,
+	}
+
+	switch v := value.(type) {
+	case *toml.Tree:
+		return tomlTreeToNode(v)
+	case []*toml.Tree:
+		node.Kind = yaml.SequenceNode
+		node.Tag = "!!seq"
+
+		for _, item := range v {
+			node.Content = append(node.Content, tomlTreeToNode(item))
+		}
+	case []interface{}:
+		node.Kind = yaml.SequenceNode
+		node.Tag = "!!seq"
+
+		for _, item := range v {
+			node.Content = append(node.Content, tomlValueToNode(item, pos))
+		}
+	case string:
+		node.Tag = "!!str"
+		node.Value = v
+	case int64:
+		node.Tag = "!!int"
+		node.Value = strconv.FormatInt(v, 10)
+	case float64:
+		node.Tag = "!!float"
+		node.Value = strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		node.Tag = "!!bool"
+		node.Value = strconv.FormatBool(v)
+	case time.Time:
+		node.Tag = "!!timestamp"
+		node.Value = v.Format(time.RFC3339Nano)
+	default:
+		node.Tag = "!!str"
+		node.Value = fmt.Sprint(v)
+	}
+
+	return node
+}
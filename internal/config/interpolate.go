@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// interpolate replaces the variables in str with their values from lookup,
+// using the following syntax:
+//
+//	$VAR, ${VAR}   the value of VAR, or "" if it's unset
+//	${VAR:-def}    def if VAR is unset or empty
+//	${VAR-def}     def if VAR is unset
+//	${VAR:?msg}    an error with msg if VAR is unset or empty
+//	${VAR?msg}     an error with msg if VAR is unset
+//	$$             a literal $
+//
+// A $ that isn't followed by a name, { or $ is kept as is, so that regexps
+// like ^vendor/$ don't need to be escaped. def and msg are interpolated too.
+func interpolate(str string, lookup func(name string) (string, bool)) (string, error) {
+	if !strings.Contains(str, "$") {
+		return str, nil
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+
+		if c != '$' || i+1 == len(str) {
+			sb.WriteByte(c)
+
+			continue
+		}
+
+		switch next := str[i+1]; {
+		case next == '$':
+			sb.WriteByte('$')
+			i++
+		case next == '{':
+			end := closingBrace(str, i+2)
+			if end == -1 {
+				return "", errors.New("unterminated ${")
+			}
+
+			value, err := expand(str[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+
+			sb.WriteString(value)
+			i = end
+		case isNameStart(next):
+			end := i + 2
+			for end < len(str) && isNameChar(str[end]) {
+				end++
+			}
+
+			value, _ := lookup(str[i+1 : end])
+			sb.WriteString(value)
+			i = end - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// expand returns the value of expr, the content of a ${...}.
+func expand(expr string, lookup func(name string) (string, bool)) (string, error) {
+	end := 0
+	for end < len(expr) && isNameChar(expr[end]) {
+		end++
+	}
+
+	name := expr[:end]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("${%v} is invalid", expr)
+	}
+
+	value, ok := lookup(name)
+	op := expr[end:]
+
+	if op == "" {
+		return value, nil
+	}
+
+	orEmpty := strings.HasPrefix(op, ":")
+	op = strings.TrimPrefix(op, ":")
+
+	if op == "" || (op[0] != '-' && op[0] != '?') {
+		return "", fmt.Errorf("${%v} is invalid", expr)
+	}
+
+	useWord := !ok || (orEmpty && value == "")
+	if !useWord {
+		return value, nil
+	}
+
+	word, err := interpolate(op[1:], lookup)
+	if err != nil {
+		return "", err
+	}
+
+	if op[0] == '?' {
+		if word == "" {
+			word = "required"
+		}
+
+		return "", fmt.Errorf("%v: %v", name, word)
+	}
+
+	return word, nil
+}
+
+// closingBrace returns the index of the } that closes the ${ before start,
+// taking nested ${...} into account, or -1 if there's none.
+func closingBrace(str string, start int) int {
+	depth := 1
+
+	for i := start; i < len(str); i++ {
+		switch {
+		case str[i] == '$' && i+1 < len(str) && str[i+1] == '{':
+			depth++
+			i++
+		case str[i] == '}':
+			depth--
+
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{
+		"HOME":  "/home/a",
+		"GOOS":  "linux",
+		"EMPTY": "",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+
+		return value, ok
+	}
+
+	tests := []struct {
+		str      string
+		res      string
+		hasError bool
+	}{
+		{"no vars", "no vars", false},
+		{"$HOME/bin", "/home/a/bin", false},
+		{"${GOOS}_amd64", "linux_amd64", false},
+		{"$UNSET", "", false},
+		{"${PORT:-8080}", "8080", false},
+		{"${EMPTY:-a}", "a", false},
+		{"${EMPTY-a}", "", false},
+		{"${UNSET-a}", "a", false},
+		{"${PORT:-${GOOS}}", "linux", false},
+		{"$$HOME", "$HOME", false},
+		{"^vendor/$", "^vendor/$", false},
+		{"{print $1}", "{print $1}", false},
+		{"${UNSET:?must be set}", "", true},
+		{"${EMPTY?must be set}", "", false},
+		{"${HOME", "", true},
+		{"${1A}", "", true},
+		{"${HOME:+a}", "", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res, err := interpolate(test.str, lookup)
+
+			if test.hasError {
+				if err == nil {
+					t.Fatalf("%v: expected err, got %v", test.str, res)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v: unexpected err: %v", test.str, err)
+			}
+
+			if res != test.res {
+				t.Errorf("%v: got %v, want %v", test.str, res, test.res)
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// schemaURL is the URL of the JSON schema draft used by the config file schema.
+const schemaURL = "https://json-schema.org/draft/2019-09/schema"
+
+// schemaID is the $id of the config file schema.
+const schemaID = "https://github.com/efreitasn/wrun/blob/master/wrun.schema.json"
+
+// Schema returns the JSON schema of the config file. It's generated from
+// configFileData using the following struct tags:
+//
+//	desc      description of the field
+//	examples  JSON array with examples of the field's value
+//	schema    comma-separated list of required, minItems=n, minimum=n,
+//	          enum=a|b|c and ref=pointer
+func Schema() []byte {
+	s := objectSchema(reflect.TypeOf(configFileData{}))
+	s = append(jsonObject{
+		{"$schema", schemaURL},
+		{"$id", schemaID},
+	}, s...)
+
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("generating schema: %v", err))
+	}
+
+	return append(bs, '\n')
+}
+
+// jsonObject is a JSON object whose keys are kept in order.
+type jsonObject []jsonField
+
+type jsonField struct {
+	key   string
+	value interface{}
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteByte('{')
+
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, err := json.Marshal(field.key)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// objectSchema returns the schema of t, which must be a struct.
+// Fields without a yaml tag are skipped.
+func objectSchema(t reflect.Type) jsonObject {
+	var props jsonObject
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		var fieldSchema jsonObject
+		var minItems, minimum string
+		var enum []string
+
+		for _, opt := range strings.Split(field.Tag.Get("schema"), ",") {
+			optName := strings.SplitN(opt, "=", 2)[0]
+			optValue := strings.TrimPrefix(opt[len(optName):], "=")
+
+			switch optName {
+			case "":
+			case "required":
+				required = append(required, name)
+			case "minItems":
+				minItems = optValue
+			case "minimum":
+				minimum = optValue
+			case "enum":
+				enum = strings.Split(optValue, "|")
+			case "ref":
+				fieldSchema = jsonObject{{"$ref", optValue}}
+			default:
+				panic(fmt.Sprintf("invalid schema option %v in %v field", opt, field.Name))
+			}
+		}
+
+		if fieldSchema == nil {
+			fieldSchema = typeSchema(field.Type)
+
+			if desc := field.Tag.Get("desc"); desc != "" {
+				// right after the type field
+				withDesc := jsonObject{fieldSchema[0], {"description", desc}}
+				fieldSchema = append(withDesc, fieldSchema[1:]...)
+			}
+
+			if examples := field.Tag.Get("examples"); examples != "" {
+				fieldSchema = append(fieldSchema, jsonField{"examples", json.RawMessage(examples)})
+			}
+
+			if minItems != "" {
+				fieldSchema = append(fieldSchema, jsonField{"minItems", json.RawMessage(minItems)})
+			}
+
+			if minimum != "" {
+				fieldSchema = append(fieldSchema, jsonField{"minimum", json.RawMessage(minimum)})
+			}
+
+			if enum != nil {
+				fieldSchema = append(fieldSchema, jsonField{"enum", enum})
+			}
+		}
+
+		props = append(props, jsonField{name, fieldSchema})
+	}
+
+	res := jsonObject{
+		{"type", "object"},
+		{"properties", props},
+		{"additionalProperties", false},
+	}
+
+	if required != nil {
+		res = append(res, jsonField{"required", required})
+	}
+
+	return res
+}
+
+// typeSchema returns the schema of t. The type field always comes first.
+func typeSchema(t reflect.Type) jsonObject {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return jsonObject{{"type", "boolean"}}
+	case reflect.Int, reflect.Int64:
+		return jsonObject{{"type", "integer"}}
+	case reflect.Float64:
+		return jsonObject{{"type", "number"}}
+	case reflect.String:
+		return jsonObject{{"type", "string"}}
+	case reflect.Slice:
+		return jsonObject{
+			{"type", "array"},
+			{"items", typeSchema(t.Elem())},
+		}
+	case reflect.Map:
+		return jsonObject{
+			{"type", "object"},
+			{"additionalProperties", typeSchema(t.Elem())},
+		}
+	case reflect.Struct:
+		return objectSchema(t)
+	}
+
+	panic(fmt.Sprintf("unsupported type %v in schema", t))
+}
+
+// schema is the subset of JSON schema used by Schema.
+type schema struct {
+	Ref                  string                `json:"$ref"`
+	Type                 string                `json:"type"`
+	Properties           map[string]*schema    `json:"properties"`
+	AdditionalProperties *additionalProperties `json:"additionalProperties"`
+	Required             []string              `json:"required"`
+	Items                *schema               `json:"items"`
+	MinItems             *int                  `json:"minItems"`
+	Minimum              *float64              `json:"minimum"`
+	Enum                 []string              `json:"enum"`
+}
+
+// additionalProperties is the value of the additionalProperties keyword,
+// which is either a boolean or the schema of the additional properties.
+type additionalProperties struct {
+	allowed bool
+	schema  *schema
+}
+
+func (ap *additionalProperties) UnmarshalJSON(bs []byte) error {
+	if err := json.Unmarshal(bs, &ap.allowed); err == nil {
+		return nil
+	}
+
+	ap.allowed = true
+
+	return json.Unmarshal(bs, &ap.schema)
+}
+
+var configSchema = mustParseSchema(Schema())
+
+func mustParseSchema(bs []byte) *schema {
+	var s schema
+
+	if err := json.Unmarshal(bs, &s); err != nil {
+		panic(fmt.Sprintf("parsing schema: %v", err))
+	}
+
+	return &s
+}
+
+// resolve returns the schema referenced by s.Ref, which must
+// be a JSON pointer relative to root, or s if s.Ref is empty.
+func (s *schema) resolve(root *schema) *schema {
+	if s.Ref == "" {
+		return s
+	}
+
+	res := root
+	tokens := strings.Split(strings.TrimPrefix(s.Ref, "#/"), "/")
+
+	for i := 0; i < len(tokens) && res != nil; i++ {
+		switch tokens[i] {
+		case "properties":
+			i++
+			if i < len(tokens) {
+				res = res.Properties[tokens[i]]
+			}
+		case "items":
+			res = res.Items
+		default:
+			res = nil
+		}
+	}
+
+	if res == nil {
+		panic(fmt.Sprintf("invalid schema reference %v", s.Ref))
+	}
+
+	return res.resolve(root)
+}
+
+// validateNode validates node against s, appending the errors found to errs.
+// path is the location of node in the config file.
+func validateNode(root, s *schema, node *yaml.Node, path string, errs ValidationErrors) ValidationErrors {
+	s = s.resolve(root)
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	newErr := func(format string, a ...interface{}) {
+		errs = append(errs, &ValidationError{
+			Path:   path,
+			Line:   node.Line,
+			Column: node.Column,
+			Msg:    fmt.Sprintf(format, a...),
+			node:   node,
+		})
+	}
+
+	switch s.Type {
+	case "object":
+		if node.Kind != yaml.MappingNode {
+			newErr("must be an object")
+
+			return errs
+		}
+
+		fields := make(map[string]bool, len(node.Content)/2)
+
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			fields[key] = true
+
+			fieldSchema, ok := s.Properties[key]
+			if !ok && s.AdditionalProperties != nil {
+				fieldSchema, ok = s.AdditionalProperties.schema, s.AdditionalProperties.schema != nil
+			}
+
+			if !ok {
+				if s.AdditionalProperties != nil && !s.AdditionalProperties.allowed {
+					errs = append(errs, &ValidationError{
+						Path:   joinPath(path, key),
+						Line:   node.Content[i].Line,
+						Column: node.Content[i].Column,
+						Msg:    "unknown field",
+						node:   node.Content[i],
+					})
+				}
+
+				continue
+			}
+
+			errs = validateNode(root, fieldSchema, value, joinPath(path, key), errs)
+		}
+
+		for _, key := range s.Required {
+			if !fields[key] {
+				errs = append(errs, &ValidationError{
+					Path:   joinPath(path, key),
+					Line:   node.Line,
+					Column: node.Column,
+					Msg:    "missing field",
+					node:   node,
+				})
+			}
+		}
+	case "array":
+		if node.Kind != yaml.SequenceNode {
+			newErr("must be an array")
+
+			return errs
+		}
+
+		if s.MinItems != nil && len(node.Content) < *s.MinItems {
+			if *s.MinItems == 1 {
+				newErr("cannot be empty")
+			} else {
+				newErr("must have at least %v items", *s.MinItems)
+			}
+		}
+
+		if s.Items != nil {
+			for i, item := range node.Content {
+				errs = validateNode(root, s.Items, item, fmt.Sprintf("%v[%v]", path, i), errs)
+			}
+		}
+	case "string":
+		// any scalar can be decoded as a string, e.g. terms: [sleep, 1]
+		if node.Kind != yaml.ScalarNode || node.ShortTag() == "!!null" {
+			newErr("must be a string")
+
+			return errs
+		}
+
+		if s.Enum != nil && !containsString(s.Enum, node.Value) {
+			newErr("must be one of %v", strings.Join(s.Enum, ", "))
+		}
+	case "boolean":
+		if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!bool" {
+			newErr("must be a boolean")
+		}
+	case "integer", "number":
+		isInt := node.Kind == yaml.ScalarNode && node.ShortTag() == "!!int"
+		isFloat := node.Kind == yaml.ScalarNode && node.ShortTag() == "!!float"
+
+		if !isInt && !(s.Type == "number" && isFloat) {
+			if s.Type == "integer" {
+				newErr("must be an integer")
+			} else {
+				newErr("must be a number")
+			}
+
+			return errs
+		}
+
+		var n float64
+		if err := node.Decode(&n); err != nil {
+			newErr("%v", err)
+
+			return errs
+		}
+
+		switch {
+		case s.Minimum == nil || n >= *s.Minimum:
+		case *s.Minimum == 0:
+			newErr("cannot be negative")
+		case *s.Minimum == 1 && s.Type == "integer":
+			newErr("must be greater than 0")
+		default:
+			newErr("must be greater than or equal to %v", *s.Minimum)
+		}
+	}
+
+	return errs
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+
+	return false
+}
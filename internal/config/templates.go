@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// templates are the built-in config file templates by name.
+var templates = map[string]string{
+	"go": `fatalIfErr: true
+ignoreRegExps:
+  - ^vendor/$
+cmds:
+  - name: build
+    terms: [go, build, ./...]
+  - name: test
+    terms: [go, test, ./...]
+  - name: run
+    terms: [go, run, .]
+`,
+	"node": `fatalIfErr: true
+ignoreRegExps:
+  - ^node_modules/$
+  - ^dist/$
+  - ^build/$
+  - ^coverage/$
+cmds:
+  - name: build
+    terms: [npm, run, build]
+  - name: test
+    terms: [npm, test]
+  - name: run
+    terms: [npm, start]
+`,
+	"python": `fatalIfErr: true
+ignoreRegExps:
+  - __pycache__/$
+  - ^venv/$
+  - ^build/$
+  - ^dist/$
+  - '\.egg-info/$'
+  - '\.pyc$'
+cmds:
+  - name: test
+    terms: [python, -m, pytest]
+`,
+	"rust": `fatalIfErr: true
+ignoreRegExps:
+  - ^target/$
+cmds:
+  - name: build
+    terms: [cargo, build]
+  - name: test
+    terms: [cargo, test]
+  - name: run
+    terms: [cargo, run]
+`,
+	"make": `fatalIfErr: true
+cmds:
+  - name: build
+    terms: [make]
+`,
+}
+
+// templateMarkers maps the files that identify a kind of project to the
+// template for it. They're checked in order, since a project can have
+// more than one of them, e.g. a go.mod and a Makefile.
+var templateMarkers = []struct {
+	fileName string
+	template string
+}{
+	{"go.mod", "go"},
+	{"Cargo.toml", "rust"},
+	{"package.json", "node"},
+	{"pyproject.toml", "python"},
+	{"setup.py", "python"},
+	{"requirements.txt", "python"},
+	{"Makefile", "make"},
+	{"GNUmakefile", "make"},
+	{"makefile", "make"},
+}
+
+// DetectTemplate returns the name of the built-in template for the project in
+// the current directory, based on the files in it. If the kind of project
+// can't be detected, it returns "".
+func DetectTemplate() string {
+	for _, marker := range templateMarkers {
+		if _, err := os.Stat(marker.fileName); err == nil {
+			return marker.template
+		}
+	}
+
+	return ""
+}
+
+// UserTemplatesDirPath returns the path of the directory with the user-defined
+// templates. A template named foo is stored in it as foo.yaml or foo.yml.
+func UserTemplatesDirPath() (string, error) {
+	configDirPath, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configDirPath, "wrun", "templates"), nil
+}
+
+// getTemplate returns the content of the template named name. User-defined
+// templates take precedence over the built-in ones.
+func getTemplate(name string) ([]byte, error) {
+	if dirPath, err := UserTemplatesDirPath(); err == nil {
+		for _, ext := range []string{".yaml", ".yml"} {
+			content, err := ioutil.ReadFile(filepath.Join(dirPath, name+ext))
+			if err == nil {
+				return content, nil
+			}
+
+			if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("reading %v template: %v", name, err)
+			}
+		}
+	}
+
+	if content, ok := templates[name]; ok {
+		return []byte(content), nil
+	}
+
+	return nil, fmt.Errorf("%v template doesn't exist", name)
+}
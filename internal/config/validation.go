@@ -0,0 +1,207 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is an error in the content of a config file.
+type ValidationError struct {
+	// File is the path of the config file with the error.
+	File string
+	// Path is the location of the invalid field, e.g. cmds[0].terms.
+	// It's empty if the error is about the config file as a whole.
+	Path string
+	// Line and Column start at 1. They're 0 if the position is unknown.
+	Line   int
+	Column int
+	Msg    string
+	// node is the node with the error, if known.
+	node *yaml.Node
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+
+	if e.File != "" {
+		sb.WriteString(e.File)
+		sb.WriteString(":")
+
+		if e.Line == 0 {
+			sb.WriteString(" ")
+		}
+	}
+
+	if e.Line > 0 {
+		sb.WriteString(fmt.Sprintf("%v:%v: ", e.Line, e.Column))
+	}
+
+	if e.Path != "" {
+		sb.WriteString(e.Path)
+		sb.WriteString(": ")
+	}
+
+	sb.WriteString(e.Msg)
+
+	return sb.String()
+}
+
+// ValidationErrors are all the errors in the content of a config file.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	strs := make([]string, 0, len(es))
+
+	for _, e := range es {
+		strs = append(strs, e.Error())
+	}
+
+	return strings.Join(strs, "\n")
+}
+
+func (es ValidationErrors) hasPath(path string) bool {
+	for _, e := range es {
+		if e.Path == path {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate validates root, the top-level node of a config file, against
+// the config file schema and returns the errors found along with the
+// data decoded from it.
+func validate(root *yaml.Node) (*configFileData, ValidationErrors) {
+	var cf configFileData
+
+	node := root
+	if node.Kind == yaml.DocumentNode {
+		node = node.Content[0]
+	}
+
+	errs := validateNode(configSchema, configSchema, node, "", nil)
+
+	if err := node.Decode(&cf); err != nil && len(errs) == 0 {
+		errs = append(errs, &ValidationError{Msg: err.Error()})
+	}
+
+	return &cf, errs
+}
+
+// locate sets the position of every error in errs that doesn't have one
+// to the position of the node at its path in root. If there's no such node,
+// the position of its closest ancestor is used.
+func (es ValidationErrors) locate(root *yaml.Node) {
+	for _, e := range es {
+		if e.Line > 0 {
+			continue
+		}
+
+		if node := findNode(root, e.Path); node != nil {
+			e.Line = node.Line
+			e.Column = node.Column
+			e.node = node
+		}
+	}
+}
+
+// setFiles sets the file of every error in es that doesn't have one to the
+// origin of its node or, if it's unknown, to defaultFilePath.
+func (es ValidationErrors) setFiles(origins map[*yaml.Node]string, defaultFilePath string) {
+	for _, e := range es {
+		if e.File != "" {
+			continue
+		}
+
+		if filePath, ok := origins[e.node]; ok {
+			e.File = filePath
+		} else {
+			e.File = defaultFilePath
+		}
+	}
+}
+
+// sort sorts es by file and position.
+func (es ValidationErrors) sort() {
+	sort.SliceStable(es, func(i, j int) bool {
+		if es[i].File != es[j].File {
+			return es[i].File < es[j].File
+		}
+
+		if es[i].Line != es[j].Line {
+			return es[i].Line < es[j].Line
+		}
+
+		return es[i].Column < es[j].Column
+	})
+}
+
+// findNode returns the node at path in root or, if there's no such node,
+// its closest ancestor.
+func findNode(root *yaml.Node, path string) *yaml.Node {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	if path == "" {
+		return node
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		key := part
+		var indexes []int
+
+		if i := strings.Index(part, "["); i != -1 {
+			key = part[:i]
+
+			for _, indexStr := range strings.Split(strings.TrimSuffix(part[i+1:], "]"), "][") {
+				index, err := strconv.Atoi(indexStr)
+				if err != nil {
+					return node
+				}
+
+				indexes = append(indexes, index)
+			}
+		}
+
+		child := mappingValue(node, key)
+		if child == nil {
+			return node
+		}
+		node = child
+
+		for _, index := range indexes {
+			if node.Kind != yaml.SequenceNode || index >= len(node.Content) {
+				return node
+			}
+
+			node = node.Content[index]
+		}
+	}
+
+	return node
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+/*
+Package fingerprint computes fingerprints of sets of files and stores them,
+so that commands whose inputs didn't change can be skipped.
+*/
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Compute returns the fingerprint of every file in the current directory
+// whose path matches at least one of inputs, recursively. Directories that
+// match at least one of ignoreRegExps aren't walked. Every string in extra
+// is also part of the fingerprint.
+func Compute(inputs, ignoreRegExps []*regexp.Regexp, extra ...string) (string, error) {
+	h := sha256.New()
+
+	for _, str := range extra {
+		io.WriteString(h, str)
+		h.Write([]byte{0})
+	}
+
+	err := walkFiles(ignoreRegExps, func(filePath string) error {
+		if !matchAny(inputs, filePath) {
+			return nil
+		}
+
+		fileHash, err := hashFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		io.WriteString(h, filePath)
+		h.Write([]byte{0})
+		h.Write(fileHash)
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Exist returns whether there's at least one file in the current directory
+// matching each of outputs, recursively. Directories that match at least
+// one of ignoreRegExps aren't walked.
+func Exist(outputs, ignoreRegExps []*regexp.Regexp) (bool, error) {
+	found := make([]bool, len(outputs))
+
+	err := walkFiles(ignoreRegExps, func(filePath string) error {
+		for i, rx := range outputs {
+			if rx.MatchString(filePath) {
+				found[i] = true
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range found {
+		if !f {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Cache stores fingerprints by key in a directory.
+type Cache struct {
+	dir string
+}
+
+// NewCache creates a cache that stores fingerprints in dir.
+// dir is only created when a fingerprint is stored.
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Key returns a key that can be used to identify fields, e.g. the terms
+// and the inputs of a command, in a cache.
+func Key(fields ...[]string) string {
+	h := sha256.New()
+
+	for _, field := range fields {
+		for _, str := range field {
+			io.WriteString(h, str)
+			h.Write([]byte{0})
+		}
+
+		// ends the field, so that {a, b}, {} and {a}, {b} differ
+		h.Write([]byte{1})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the fingerprint stored for key.
+// If there's none, an empty string is returned.
+func (c *Cache) Get(key string) (string, error) {
+	bs, err := ioutil.ReadFile(path.Join(c.dir, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return strings.TrimSpace(string(bs)), nil
+}
+
+// Set stores fp as the fingerprint for key.
+func (c *Cache) Set(key, fp string) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+
+	if err := os.MkdirAll(c.dir, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(c.dir, key), []byte(fp+"\n"), 0666)
+}
+
+// walkFiles calls fn for every file in the current directory, recursively,
+// in lexical order.
+func walkFiles(ignoreRegExps []*regexp.Regexp, fn func(filePath string) error) error {
+	return filepath.Walk(".", func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filePath == "." {
+			return nil
+		}
+
+		filePath = filepath.ToSlash(filePath)
+
+		if info.IsDir() {
+			if matchAny(ignoreRegExps, filePath+"/") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !info.Mode().IsRegular() || matchAny(ignoreRegExps, filePath) {
+			return nil
+		}
+
+		return fn(filePath)
+	})
+}
+
+func hashFile(filePath string) ([]byte, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return h.Sum(nil), nil
+}
+
+func matchAny(rxs []*regexp.Regexp, str string) bool {
+	for _, rx := range rxs {
+		if rx.MatchString(str) {
+			return true
+		}
+	}
+
+	return false
+}
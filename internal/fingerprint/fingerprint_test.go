@@ -0,0 +1,172 @@
+package fingerprint
+
+import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	writeFile(t, "a/b/c.go", "package c")
+	writeFile(t, "a/b/c.txt", "foo")
+
+	inputs := []*regexp.Regexp{regexp.MustCompile(`^a/.*\.go$`)}
+
+	fp, err := Compute(inputs, nil, "go", "build")
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	t.Run("non-input file changed", func(t *testing.T) {
+		writeFile(t, "a/b/c.txt", "bar")
+
+		newFp, err := Compute(inputs, nil, "go", "build")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if newFp != fp {
+			t.Errorf("got %v, want %v", newFp, fp)
+		}
+	})
+
+	t.Run("different extra", func(t *testing.T) {
+		newFp, err := Compute(inputs, nil, "go", "test")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if newFp == fp {
+			t.Errorf("got %v, want a different fingerprint", newFp)
+		}
+	})
+
+	t.Run("input file in ignored dir changed", func(t *testing.T) {
+		ignoreRegExps := []*regexp.Regexp{regexp.MustCompile("^a/b/$")}
+
+		ignoredFp, err := Compute(inputs, ignoreRegExps, "go", "build")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		writeFile(t, "a/b/c.go", "package d")
+
+		newFp, err := Compute(inputs, ignoreRegExps, "go", "build")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if newFp != ignoredFp {
+			t.Errorf("got %v, want %v", newFp, ignoredFp)
+		}
+	})
+
+	t.Run("input file changed", func(t *testing.T) {
+		writeFile(t, "a/b/c.go", "package e")
+
+		newFp, err := Compute(inputs, nil, "go", "build")
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+
+		if newFp == fp {
+			t.Errorf("got %v, want a different fingerprint", newFp)
+		}
+	})
+}
+
+func TestExist(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	writeFile(t, "a/b/bin", "")
+
+	exist, err := Exist([]*regexp.Regexp{regexp.MustCompile("^a/b/bin$")}, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if !exist {
+		t.Errorf("got %v, want %v", exist, true)
+	}
+
+	exist, err = Exist([]*regexp.Regexp{
+		regexp.MustCompile("^a/b/bin$"),
+		regexp.MustCompile("^a/b/lib$"),
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if exist {
+		t.Errorf("got %v, want %v", exist, false)
+	}
+}
+
+func TestCache(t *testing.T) {
+	defer os.RemoveAll("a")
+
+	c := NewCache("a/cache")
+	key := Key([]string{"go", "build"})
+
+	fp, err := c.Get(key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if fp != "" {
+		t.Errorf("got %v, want empty string", fp)
+	}
+
+	if err := c.Set(key, "abc"); err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	fp, err = c.Get(key)
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	if fp != "abc" {
+		t.Errorf("got %v, want %v", fp, "abc")
+	}
+}
+
+func writeFile(t *testing.T, filePath, content string) {
+	t.Helper()
+
+	err := ioutil.WriteFile(filePath, []byte(content), os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		a, b [][]string
+		same bool
+	}{
+		{[][]string{{"go", "build"}}, [][]string{{"go", "build"}}, true},
+		{[][]string{{"go", "build"}}, [][]string{{"go", "test"}}, false},
+		{[][]string{{"go", "build"}, {"a"}}, [][]string{{"go", "build"}, {"b"}}, false},
+		{[][]string{{"go", "build"}, {}}, [][]string{{"go"}, {"build"}}, false},
+		{[][]string{{"go", "build"}}, [][]string{{"go", "build"}, {}}, false},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			same := Key(test.a...) == Key(test.b...)
+
+			if same != test.same {
+				t.Errorf("got %v, want %v", same, test.same)
+			}
+		})
+	}
+}
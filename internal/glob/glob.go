@@ -0,0 +1,198 @@
+/*
+Package glob converts glob patterns to regular expressions, so that they can be
+used wherever wrun matches paths against regular expressions.
+
+Patterns are matched against the whole path, which is relative to the watched
+directory. The following syntax is supported:
+
+	pattern  matches
+	*        any sequence of characters except /
+	?        any single character except /
+	**       any sequence of characters, including /
+	[...]    a character class; [!...] and [^...] negate it
+	{a,b}    either a or b
+*/
+package glob
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Compile converts pattern to an anchored regular expression.
+func Compile(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	inGroup := false
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				atSegmentStart := i == 0 || pattern[i-1] == '/'
+
+				switch {
+				case atSegmentStart && i+2 < len(pattern) && pattern[i+2] == '/':
+					// "**/" matches zero or more directories
+					sb.WriteString("(?:.*/)?")
+					i += 2
+				case atSegmentStart && i+2 == len(pattern) && i > 0:
+					// "/**" matches everything inside a directory,
+					// so the / that precedes it is made optional.
+					str := sb.String()
+					sb.Reset()
+					sb.WriteString(strings.TrimSuffix(str, "/"))
+					sb.WriteString("(?:/.*)?")
+					i++
+				default:
+					sb.WriteString(".*")
+					i++
+				}
+
+				continue
+			}
+
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			j := i + 1
+
+			negated := j < len(pattern) && (pattern[j] == '!' || pattern[j] == '^')
+			if negated {
+				j++
+			}
+
+			// a ] right after the [ or the negation is part of the class
+			start := j
+			if j < len(pattern) && pattern[j] == ']' {
+				j++
+			}
+
+			end := strings.IndexByte(pattern[j:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("%v glob is invalid: unterminated [", pattern)
+			}
+
+			sb.WriteString("[")
+			if negated {
+				sb.WriteString("^")
+			}
+			writeClass(&sb, pattern[start:j+end])
+			sb.WriteString("]")
+
+			i = j + end
+		case '{':
+			if inGroup {
+				return nil, fmt.Errorf("%v glob is invalid: nested {", pattern)
+			}
+
+			inGroup = true
+			sb.WriteString("(?:")
+		case '}':
+			if !inGroup {
+				return nil, fmt.Errorf("%v glob is invalid: unexpected }", pattern)
+			}
+
+			inGroup = false
+			sb.WriteString(")")
+		case ',':
+			if inGroup {
+				sb.WriteString("|")
+			} else {
+				sb.WriteString(",")
+			}
+		default:
+			sb.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	if inGroup {
+		return nil, fmt.Errorf("%v glob is invalid: unterminated {", pattern)
+	}
+
+	sb.WriteString("$")
+
+	rx, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("%v glob is invalid: %v", pattern, err)
+	}
+
+	return rx, nil
+}
+
+// writeClass writes the characters of a character class to sb. Every character
+// is taken literally, except for a - between two characters, which is a range.
+func writeClass(sb *strings.Builder, class string) {
+	for i := 0; i < len(class); i++ {
+		c := class[i]
+
+		switch {
+		case c == '-' && i > 0 && i < len(class)-1:
+			sb.WriteByte('-')
+		case c < utf8.RuneSelf && !isAlnum(c):
+			// any punctuation can be escaped in a class
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func isAlnum(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// CompileAll compiles every pattern in patterns.
+func CompileAll(patterns []string) ([]*regexp.Regexp, error) {
+	rxs := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		rx, err := Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		rxs = append(rxs, rx)
+	}
+
+	return rxs, nil
+}
+
+// SplitList splits a comma-separated list of patterns. Commas
+// inside {...} are part of the patterns and don't separate them.
+// Empty patterns are dropped.
+func SplitList(str string) []string {
+	var patterns []string
+
+	start := 0
+	inGroup := false
+
+	for i := 0; i <= len(str); i++ {
+		if i < len(str) {
+			switch str[i] {
+			case '{':
+				inGroup = true
+			case '}':
+				inGroup = false
+			}
+
+			if str[i] != ',' || inGroup {
+				continue
+			}
+		}
+
+		if pattern := str[start:i]; pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+		start = i + 1
+	}
+
+	return patterns
+}
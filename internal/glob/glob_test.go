@@ -0,0 +1,95 @@
+package glob
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"go.mod", "go.mod", true},
+		{"go.mod", "a/go.mod", false},
+		{"*.go", "main.go", true},
+		{"*.go", "a/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/main.go", true},
+		{"**/*.go", "a/b/main.js", false},
+		{"a/**", "a", true},
+		{"a/**", "a/b/c.txt", true},
+		{"a/**", "ab/c.txt", false},
+		{"a/**/c.txt", "a/c.txt", true},
+		{"a/**/c.txt", "a/b/d/c.txt", true},
+		{"a?.txt", "ab.txt", true},
+		{"a?.txt", "a/.txt", false},
+		{"[ab].txt", "b.txt", true},
+		{"[!ab].txt", "b.txt", false},
+		{"*.{go,mod}", "go.mod", true},
+		{"*.{go,mod}", "go.sum", false},
+		{"a+b.txt", "a+b.txt", true},
+		{"[a-c].txt", "b.txt", true},
+		{"[!a-c].txt", "d.txt", true},
+		{"[^ab].txt", "b.txt", false},
+		{"[a-].txt", "-.txt", true},
+		{"[a-].txt", "b.txt", false},
+		{"[-a].txt", "-.txt", true},
+		{"[\\].txt", "\\.txt", true},
+		{"[]a].txt", "].txt", true},
+		{"[!]a].txt", "].txt", false},
+		{"[.].txt", "a.txt", false},
+		{"[[].txt", "[.txt", true},
+		{"[é].txt", "é.txt", true},
+		{"é.txt", "é.txt", true},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			rx, err := Compile(test.pattern)
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			if match := rx.MatchString(test.path); match != test.match {
+				t.Errorf("%v against %v: got %v, want %v", test.pattern, test.path, match, test.match)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	patterns := []string{"[ab", "[]", "[c-a]", "{a,b", "a}", "{a,{b}}"}
+
+	for _, pattern := range patterns {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := Compile(pattern); err == nil {
+				t.Errorf("got nil, want error")
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		str      string
+		patterns []string
+	}{
+		{"", nil},
+		{"*.go", []string{"*.go"}},
+		{"*.go,go.mod", []string{"*.go", "go.mod"}},
+		{"*.{go,mod},,a/**", []string{"*.{go,mod}", "a/**"}},
+	}
+
+	for i, test := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			patterns := SplitList(test.str)
+
+			if !reflect.DeepEqual(patterns, test.patterns) {
+				t.Errorf("got %q, want %q", patterns, test.patterns)
+			}
+		})
+	}
+}
@@ -2,18 +2,67 @@ package watcher
 
 import (
 	"fmt"
+	"time"
 )
 
+// Op is the operation represented by an event.
+type Op uint8
+
+// Event operations.
+const (
+	CreateOp Op = iota + 1
+	DeleteOp
+	ModifyOp
+	RenameOp
+)
+
+func (op Op) String() string {
+	switch op {
+	case CreateOp:
+		return "CREATE"
+	case DeleteOp:
+		return "DELETE"
+	case ModifyOp:
+		return "MODIFY"
+	case RenameOp:
+		return "RENAME"
+	default:
+		return fmt.Sprintf("Op(%d)", uint8(op))
+	}
+}
+
 // Event is an event emitted by a watcher.
 type Event interface {
 	fmt.Stringer
 	WatcherEvent() string
 	IsDir() bool
 	Path() string
+	Op() Op
+	Time() time.Time
+	Seq() uint64
+}
+
+// eventMeta holds the data shared by every event.
+type eventMeta struct {
+	time time.Time
+	seq  uint64
+}
+
+// Time returns the time at which the event was read from the inotify instance's fd.
+func (em eventMeta) Time() time.Time {
+	return em.time
+}
+
+// Seq returns the event's sequence number.
+// Sequence numbers start at 1 and are monotonically increasing
+// for every event emitted by the same watcher.
+func (em eventMeta) Seq() uint64 {
+	return em.seq
 }
 
 // CreateEvent represents the creation of a file or directory.
 type CreateEvent struct {
+	eventMeta
 	path  string
 	isDir bool
 }
@@ -28,6 +77,11 @@ func (ce CreateEvent) Path() string {
 	return ce.path
 }
 
+// Op returns CreateOp.
+func (ce CreateEvent) Op() Op {
+	return CreateOp
+}
+
 // WatcherEvent returns a string representation of the event.
 func (ce CreateEvent) WatcherEvent() string {
 	str := fmt.Sprintf("CREATE %v", ce.path)
@@ -41,6 +95,7 @@ func (ce CreateEvent) String() string {
 
 // DeleteEvent represents the removal of a file or directory.
 type DeleteEvent struct {
+	eventMeta
 	path  string
 	isDir bool
 }
@@ -55,6 +110,11 @@ func (de DeleteEvent) Path() string {
 	return de.path
 }
 
+// Op returns DeleteOp.
+func (de DeleteEvent) Op() Op {
+	return DeleteOp
+}
+
 // WatcherEvent returns a string representation of the event.
 func (de DeleteEvent) WatcherEvent() string {
 	str := fmt.Sprintf("DELETE %v", de.path)
@@ -68,6 +128,7 @@ func (de DeleteEvent) String() string {
 
 // ModifyEvent represents the modification of a file or directory.
 type ModifyEvent struct {
+	eventMeta
 	path string
 }
 
@@ -81,6 +142,11 @@ func (me ModifyEvent) Path() string {
 	return me.path
 }
 
+// Op returns ModifyOp.
+func (me ModifyEvent) Op() Op {
+	return ModifyOp
+}
+
 // WatcherEvent returns a string representation of the event.
 func (me ModifyEvent) WatcherEvent() string {
 	str := fmt.Sprintf("MODIFY %v", me.path)
@@ -94,10 +160,12 @@ func (me ModifyEvent) String() string {
 
 // RenameEvent represents the moving of a file or directory.
 type RenameEvent struct {
+	eventMeta
 	// OldPath can be equal to "" if the old path is from an unwatched directory.
 	OldPath string
 	path    string
 	isDir   bool
+	cookie  uint32
 }
 
 // IsDir returns whether the event item is a directory.
@@ -111,6 +179,17 @@ func (re RenameEvent) Path() string {
 	return re.path
 }
 
+// Op returns RenameOp.
+func (re RenameEvent) Op() Op {
+	return RenameOp
+}
+
+// Cookie returns the inotify cookie that relates the IN_MOVED_FROM and
+// IN_MOVED_TO events which originated the rename.
+func (re RenameEvent) Cookie() uint32 {
+	return re.cookie
+}
+
 // WatcherEvent returns a string representation of the event.
 func (re RenameEvent) WatcherEvent() string {
 	var str string
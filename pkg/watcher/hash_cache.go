@@ -0,0 +1,138 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultHashSizeLimit is the default size in bytes above which
+// files are compared by size and modification time instead of by
+// the hash of their content.
+const defaultHashSizeLimit = 4 << 20
+
+// fileFingerprint identifies the content of a file.
+// If hashed is false, the file was too big to be hashed and only
+// size and modTime are meaningful.
+type fileFingerprint struct {
+	size    int64
+	modTime time.Time
+	hashed  bool
+	hash    [sha256.Size]byte
+}
+
+// hashCache keeps the fingerprint of the content of watched files,
+// so that writes that don't change a file's content can be detected.
+type hashCache struct {
+	sizeLimit int64
+	items     map[string]fileFingerprint
+}
+
+func newHashCache(sizeLimit int64) *hashCache {
+	if sizeLimit <= 0 {
+		sizeLimit = defaultHashSizeLimit
+	}
+
+	return &hashCache{
+		sizeLimit: sizeLimit,
+		items:     map[string]fileFingerprint{},
+	}
+}
+
+// update computes the fingerprint of the file at path, stores it and returns
+// whether it's different from the previously stored one. If there's no stored
+// fingerprint for path or if it can't be computed, the file is considered
+// to have changed.
+func (hc *hashCache) update(path string) bool {
+	fp, err := hc.fingerprint(path)
+	if err != nil {
+		delete(hc.items, path)
+
+		return true
+	}
+
+	previousFp, ok := hc.items[path]
+	hc.items[path] = fp
+
+	if !ok || fp.hashed != previousFp.hashed || fp.size != previousFp.size {
+		return true
+	}
+
+	if fp.hashed {
+		return fp.hash != previousFp.hash
+	}
+
+	return !fp.modTime.Equal(previousFp.modTime)
+}
+
+// rm removes the fingerprint of path and of every path inside it.
+func (hc *hashCache) rm(path string) {
+	delete(hc.items, path)
+
+	prefix := path + "/"
+	for p := range hc.items {
+		if strings.HasPrefix(p, prefix) {
+			delete(hc.items, p)
+		}
+	}
+}
+
+func (hc *hashCache) fingerprint(path string) (fileFingerprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileFingerprint{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fileFingerprint{}, err
+	}
+
+	fp := fileFingerprint{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}
+
+	if fp.size > hc.sizeLimit {
+		return fp, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fileFingerprint{}, err
+	}
+
+	fp.hashed = true
+	copy(fp.hash[:], h.Sum(nil))
+
+	return fp, nil
+}
+
+// updateFromEvent updates the fingerprints affected by e, an event detected
+// by diffing two snapshots, and returns whether e must be emitted, which isn't
+// the case for a ModifyEvent of a file whose content didn't change.
+func (hc *hashCache) updateFromEvent(e Event) bool {
+	switch e := e.(type) {
+	case ModifyEvent:
+		return hc.update(e.Path())
+	case CreateEvent:
+		if !e.IsDir() {
+			hc.update(e.Path())
+		}
+	case DeleteEvent:
+		hc.rm(e.Path())
+	case RenameEvent:
+		hc.rm(e.OldPath)
+
+		if e.IsDir() {
+			hc.rm(e.Path())
+		} else {
+			hc.update(e.Path())
+		}
+	}
+
+	return true
+}
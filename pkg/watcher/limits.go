@@ -0,0 +1,189 @@
+package watcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyProcDirPath is the path of the directory with the inotify limits.
+const inotifyProcDirPath = "/proc/sys/fs/inotify"
+
+// Limits are the system-wide inotify limits.
+// A value of -1 means it couldn't be read.
+type Limits struct {
+	MaxUserWatches   int
+	MaxUserInstances int
+	MaxQueuedEvents  int
+}
+
+// InotifyLimits returns the inotify limits as defined in /proc/sys/fs/inotify.
+func InotifyLimits() (Limits, error) {
+	l := Limits{-1, -1, -1}
+
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"max_user_watches", &l.MaxUserWatches},
+		{"max_user_instances", &l.MaxUserInstances},
+		{"max_queued_events", &l.MaxQueuedEvents},
+	}
+
+	for _, field := range fields {
+		bs, err := ioutil.ReadFile(path.Join(inotifyProcDirPath, field.name))
+		if err != nil {
+			return l, fmt.Errorf("reading %v: %v", field.name, err)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(string(bs)))
+		if err != nil {
+			return l, fmt.Errorf("parsing %v: %v", field.name, err)
+		}
+
+		*field.value = n
+	}
+
+	return l, nil
+}
+
+// WatchLimitError is the error returned when an inotify instance can't be created
+// or a directory can't be watched because an inotify limit has been reached.
+type WatchLimitError struct {
+	// Path is the path of the directory that couldn't be watched.
+	// It's empty if the inotify instance couldn't be created.
+	Path string
+	// Err is either unix.ENOSPC or unix.EMFILE.
+	Err    error
+	Limits Limits
+	// Needed is the number of directories that need to be watched.
+	// It's -1 if it's unknown.
+	Needed int
+}
+
+func (e *WatchLimitError) Error() string {
+	var sb strings.Builder
+
+	if e.Path == "" {
+		sb.WriteString(fmt.Sprintf("creating inotify instance: %v", e.Err))
+	} else {
+		sb.WriteString(fmt.Sprintf("adding %v to inotify instance: %v", e.Path, e.Err))
+	}
+
+	switch e.Err {
+	case unix.ENOSPC:
+		sb.WriteString(fmt.Sprintf(
+			" (fs.inotify.max_user_watches is %v",
+			limitStr(e.Limits.MaxUserWatches),
+		))
+
+		if e.Needed >= 0 {
+			sb.WriteString(fmt.Sprintf(" and %v directories need to be watched", e.Needed))
+		}
+
+		sb.WriteString("; it can be increased with sysctl)")
+	case unix.EMFILE:
+		sb.WriteString(fmt.Sprintf(
+			" (fs.inotify.max_user_instances is %v; it can be increased with sysctl)",
+			limitStr(e.Limits.MaxUserInstances),
+		))
+	}
+
+	return sb.String()
+}
+
+func (e *WatchLimitError) Unwrap() error {
+	return e.Err
+}
+
+// isLimitErr returns whether err means that an inotify limit has been reached.
+func isLimitErr(err error) bool {
+	return err == unix.ENOSPC || err == unix.EMFILE
+}
+
+// CountDirs returns the number of directories a watcher created with dirPath
+// and ignoreRegExps would watch, including dirPath itself.
+func CountDirs(dirPath string, ignoreRegExps []*regexp.Regexp) (int, error) {
+	d, err := Scan(dirPath, ignoreRegExps)
+	if err != nil {
+		return 0, err
+	}
+
+	n, _, _ := d.Count()
+
+	return n, nil
+}
+
+func limitStr(n int) string {
+	if n < 0 {
+		return "unknown"
+	}
+
+	return strconv.Itoa(n)
+}
+
+// Usage is the number of inotify instances and watches
+// in use by the processes of the current user.
+type Usage struct {
+	Instances int
+	Watches   int
+}
+
+// InotifyUsage returns the number of inotify instances and watches in use by
+// the processes of the current user, by inspecting /proc. Processes whose fds
+// can't be inspected are skipped.
+func InotifyUsage() (Usage, error) {
+	var u Usage
+
+	procEntries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return u, err
+	}
+
+	uid := uint32(unix.Getuid())
+
+	for _, procEntry := range procEntries {
+		if _, err := strconv.Atoi(procEntry.Name()); err != nil || !procEntry.IsDir() {
+			continue
+		}
+
+		if st, ok := procEntry.Sys().(*syscall.Stat_t); !ok || st.Uid != uid {
+			continue
+		}
+
+		fdDirPath := path.Join("/proc", procEntry.Name(), "fd")
+		fdEntries, err := ioutil.ReadDir(fdDirPath)
+		if err != nil {
+			continue
+		}
+
+		for _, fdEntry := range fdEntries {
+			target, err := os.Readlink(path.Join(fdDirPath, fdEntry.Name()))
+			if err != nil || target != "anon_inode:inotify" {
+				continue
+			}
+
+			u.Instances++
+
+			bs, err := ioutil.ReadFile(path.Join("/proc", procEntry.Name(), "fdinfo", fdEntry.Name()))
+			if err != nil {
+				continue
+			}
+
+			for _, line := range strings.Split(string(bs), "\n") {
+				if strings.HasPrefix(line, "inotify wd:") {
+					u.Watches++
+				}
+			}
+		}
+	}
+
+	return u, nil
+}
@@ -10,6 +10,7 @@ type mvFromEvent struct {
 	parentWd int
 	name     string
 	isDir    bool
+	time     time.Time
 	done     chan struct{}
 }
 
@@ -20,29 +21,44 @@ type mvToEvent struct {
 }
 
 type mvEvent struct {
+	cookie      int
 	oldParentWd int
 	newParentWd int
 	oldName     string
 	newName     string
 	isDir       bool
+	// time is the time at which the first event of the pair was read.
+	time time.Time
 }
 
+// defaultRenameWindow is the default amount of time to wait for
+// an IN_MOVED_TO event after an IN_MOVED_FROM event.
+const defaultRenameWindow = 100 * time.Millisecond
+
 type mvEvents struct {
 	mx     sync.Mutex
 	mvFrom map[int]*mvFromEvent
 	queue  chan *mvEvent
 	done   chan struct{}
+	// window is the amount of time to wait for an IN_MOVED_TO event
+	// with the same cookie as an IN_MOVED_FROM event.
+	window time.Duration
 }
 
-func newMvEvents() *mvEvents {
+func newMvEvents(window time.Duration) *mvEvents {
+	if window <= 0 {
+		window = defaultRenameWindow
+	}
+
 	return &mvEvents{
 		queue:  make(chan *mvEvent, 1),
 		mvFrom: map[int]*mvFromEvent{},
 		done:   make(chan struct{}),
+		window: window,
 	}
 }
 
-func (me *mvEvents) addMvFrom(cookie int, name string, parentWd int, isDir bool) {
+func (me *mvEvents) addMvFrom(cookie int, name string, parentWd int, isDir bool, t time.Time) {
 	done := make(chan struct{})
 
 	me.mx.Lock()
@@ -51,6 +67,7 @@ func (me *mvEvents) addMvFrom(cookie int, name string, parentWd int, isDir bool)
 		parentWd: parentWd,
 		name:     name,
 		isDir:    isDir,
+		time:     t,
 		done:     done,
 	}
 	me.mx.Unlock()
@@ -59,12 +76,14 @@ func (me *mvEvents) addMvFrom(cookie int, name string, parentWd int, isDir bool)
 		select {
 		case <-done:
 		case <-me.done:
-		case <-time.After(time.Millisecond * 100):
+		case <-time.After(me.window):
 			me.queue <- &mvEvent{
+				cookie:      cookie,
 				oldParentWd: parentWd,
 				oldName:     name,
 				newParentWd: -1,
 				isDir:       isDir,
+				time:        t,
 			}
 		}
 
@@ -74,7 +93,7 @@ func (me *mvEvents) addMvFrom(cookie int, name string, parentWd int, isDir bool)
 	}()
 }
 
-func (me *mvEvents) addMvTo(cookie int, name string, parentWd int, isDir bool) {
+func (me *mvEvents) addMvTo(cookie int, name string, parentWd int, isDir bool, t time.Time) {
 	me.mx.Lock()
 	mvFrom := me.mvFrom[cookie]
 	me.mx.Unlock()
@@ -87,20 +106,25 @@ func (me *mvEvents) addMvTo(cookie int, name string, parentWd int, isDir bool) {
 		close(mvFrom.done)
 
 		me.queue <- &mvEvent{
+			cookie:      cookie,
 			oldParentWd: mvFrom.parentWd,
 			oldName:     mvFrom.name,
 			newParentWd: parentWd,
 			newName:     name,
 			isDir:       isDir,
+			time:        mvFrom.time,
 		}
 
 		return
 	}
 
 	me.queue <- &mvEvent{
+		cookie:      cookie,
 		oldParentWd: -1,
 		newParentWd: parentWd,
 		newName:     name,
+		isDir:       isDir,
+		time:        t,
 	}
 }
 
@@ -0,0 +1,154 @@
+package watcher
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPollInterval is the default interval between two polls
+// of the directories that couldn't be watched.
+const defaultPollInterval = time.Second
+
+// polledDirs is the set of directories that are polled instead of being
+// watched because an inotify limit has been reached. Each directory is polled
+// recursively and maps to its last snapshot.
+type polledDirs struct {
+	mx    sync.Mutex
+	items map[string]snapshot
+}
+
+// polledChange is a change detected in a polled directory.
+type polledChange struct {
+	old snapshot
+	cur snapshot
+}
+
+// poll starts polling the directory at dirPath. If unchanged writes are
+// skipped, it also stores the fingerprint of every file found, since the
+// changes detected by polling go through w.hashes as well.
+func (w *W) poll(dirPath string) error {
+	s, err := w.takeSnapshot(dirPath, w.snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	if w.hashes != nil {
+		for p, se := range s {
+			if !se.IsDir {
+				w.hashes.update(p)
+			}
+		}
+	}
+
+	w.polled.mx.Lock()
+	defer w.polled.mx.Unlock()
+
+	w.polled.items[dirPath] = s
+
+	return nil
+}
+
+// unpoll stops polling the directory at dirPath and every polled directory
+// inside it and returns whether any of them was being polled.
+func (w *W) unpoll(dirPath string) bool {
+	if w.polled == nil {
+		return false
+	}
+
+	w.polled.mx.Lock()
+	defer w.polled.mx.Unlock()
+
+	found := false
+	for p := range w.polled.items {
+		if p == dirPath || strings.HasPrefix(p, dirPath+"/") {
+			delete(w.polled.items, p)
+			found = true
+		}
+	}
+
+	return found
+}
+
+// Polled returns the paths of the directories that are being polled
+// instead of being watched because an inotify limit has been reached.
+func (w *W) Polled() []string {
+	if w.polled == nil {
+		return nil
+	}
+
+	w.polled.mx.Lock()
+	defer w.polled.mx.Unlock()
+
+	paths := make([]string, 0, len(w.polled.items))
+	for p := range w.polled.items {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// startPolling polls every polled directory every w.pollInterval and sends
+// the detected changes to w.polledChanges.
+func (w *W) startPolling() {
+	go func() {
+		ticker := time.NewTicker(w.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+
+			for _, dirPath := range w.Polled() {
+				cur, err := w.takeSnapshot(dirPath, w.snapshotPath)
+				// if the directory can't be read anymore, it's most likely been
+				// removed, which is reported by its parent directory's watch.
+				if err != nil {
+					continue
+				}
+
+				w.polled.mx.Lock()
+				old, ok := w.polled.items[dirPath]
+				if ok {
+					w.polled.items[dirPath] = cur
+				}
+				w.polled.mx.Unlock()
+
+				if !ok || sameSnapshot(old, cur) {
+					continue
+				}
+
+				select {
+				case <-w.done:
+					return
+				case w.polledChanges <- polledChange{old, cur}:
+				}
+			}
+		}
+	}()
+}
+
+func sameSnapshot(a, b snapshot) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for p, ae := range a {
+		be, ok := b[p]
+		if !ok ||
+			ae.IsDir != be.IsDir ||
+			ae.Size != be.Size ||
+			ae.Inode != be.Inode ||
+			!ae.ModTime.Equal(be.ModTime) {
+			return false
+		}
+	}
+
+	return true
+}
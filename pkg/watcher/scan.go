@@ -0,0 +1,88 @@
+package watcher
+
+import (
+	"path"
+	"regexp"
+)
+
+// Dir is a directory that a watcher would watch.
+type Dir struct {
+	Path string
+	// Dirs are the subdirectories that would be watched.
+	Dirs []*Dir
+	// Files are the paths of the files whose events would be reported.
+	Files []string
+	// Ignored are the files and directories that would be ignored.
+	// The contents of ignored directories aren't scanned.
+	Ignored []IgnoredItem
+}
+
+// IgnoredItem is a file or directory that a watcher would ignore.
+type IgnoredItem struct {
+	Path  string
+	IsDir bool
+	// RegExp is the regexp that matched the item.
+	RegExp *regexp.Regexp
+}
+
+// Count returns the number of watched directories, including d itself, watched
+// files and ignored items in the tree starting at d.
+func (d *Dir) Count() (dirs, files, ignored int) {
+	dirs, files, ignored = 1, len(d.Files), len(d.Ignored)
+
+	for _, child := range d.Dirs {
+		childDirs, childFiles, childIgnored := child.Count()
+
+		dirs += childDirs
+		files += childFiles
+		ignored += childIgnored
+	}
+
+	return dirs, files, ignored
+}
+
+// Scan returns the tree of directories that a watcher created with dirPath
+// and ignoreRegExps would watch, starting at dirPath. The tree is built by
+// walking the directories the same way as when they're added to a watcher.
+func Scan(dirPath string, ignoreRegExps []*regexp.Regexp) (*Dir, error) {
+	root := &Dir{Path: dirPath}
+	v := scanVisitor{
+		dirs: map[string]*Dir{dirPath: root},
+	}
+
+	if err := walkDirs(dirPath, ignoreRegExps, v); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// scanVisitor builds the tree returned by Scan.
+type scanVisitor struct {
+	// dirs maps the path of every directory walked to its Dir.
+	dirs map[string]*Dir
+}
+
+func (v scanVisitor) dir(parentPath, name string) (bool, error) {
+	d := &Dir{Path: path.Join(parentPath, name)}
+
+	parent := v.dirs[parentPath]
+	parent.Dirs = append(parent.Dirs, d)
+	v.dirs[d.Path] = d
+
+	return true, nil
+}
+
+func (v scanVisitor) file(parentPath, name string) {
+	parent := v.dirs[parentPath]
+	parent.Files = append(parent.Files, path.Join(parentPath, name))
+}
+
+func (v scanVisitor) ignored(parentPath, name string, isDir bool, rx *regexp.Regexp) {
+	parent := v.dirs[parentPath]
+	parent.Ignored = append(parent.Ignored, IgnoredItem{
+		Path:   path.Join(parentPath, name),
+		IsDir:  isDir,
+		RegExp: rx,
+	})
+}
@@ -0,0 +1,299 @@
+package watcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// snapshotEntry is the state of a file or directory at the time
+// a snapshot was taken.
+type snapshotEntry struct {
+	Path    string    `json:"path"`
+	IsDir   bool      `json:"isDir,omitempty"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Inode   uint64    `json:"inode"`
+}
+
+// snapshot maps paths to their state.
+type snapshot map[string]snapshotEntry
+
+// takeSnapshot returns the state of every file and directory inside rootPath,
+// recursively, skipping the ones that match any of w.ignoreRegExps as well as
+// skipPath.
+func (w *W) takeSnapshot(rootPath, skipPath string) (snapshot, error) {
+	s := snapshot{}
+
+	err := w.addToSnapshot(s, rootPath, cleanPath(skipPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (w *W) addToSnapshot(s snapshot, dirPath, skipPath string) error {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.Name())
+
+		if entryPath == skipPath || w.matchPath(entryPath, entry.IsDir()) {
+			continue
+		}
+
+		se := snapshotEntry{
+			Path:    entryPath,
+			IsDir:   entry.IsDir(),
+			ModTime: entry.ModTime(),
+		}
+
+		if !se.IsDir {
+			se.Size = entry.Size()
+		}
+
+		if st, ok := entry.Sys().(*syscall.Stat_t); ok {
+			se.Inode = st.Ino
+		}
+
+		s[entryPath] = se
+
+		if se.IsDir {
+			if err := w.addToSnapshot(s, entryPath, skipPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readSnapshot reads the snapshot stored at filePath.
+// If there's no file at filePath, a nil snapshot is returned.
+func readSnapshot(filePath string) (snapshot, error) {
+	bs, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var entries []snapshotEntry
+	if err := json.Unmarshal(bs, &entries); err != nil {
+		return nil, err
+	}
+
+	s := make(snapshot, len(entries))
+	for _, se := range entries {
+		s[se.Path] = se
+	}
+
+	return s, nil
+}
+
+// writeSnapshot stores s at filePath, creating its parent directories if needed.
+func writeSnapshot(filePath string, s snapshot) error {
+	entries := make([]snapshotEntry, 0, len(s))
+	for _, se := range s {
+		entries = append(entries, se)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	bs, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	if dir := path.Dir(filePath); dir != "." {
+		if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	return ioutil.WriteFile(filePath, bs, 0666)
+}
+
+// diffSnapshots returns the events needed to go from old to cur.
+// Events about the items inside a created, deleted or renamed directory
+// aren't returned, the same way it happens with events read from an inotify
+// instance. Deletions come first, followed by renames, creations and
+// modifications, each of them sorted by path.
+func diffSnapshots(old, cur snapshot, newMeta func() eventMeta) []Event {
+	oldByInode := map[uint64]snapshotEntry{}
+	for _, se := range old {
+		if se.Inode != 0 {
+			oldByInode[se.Inode] = se
+		}
+	}
+
+	// renamedFrom maps an old path to its new path.
+	renamedFrom := map[string]string{}
+	var created, modified []snapshotEntry
+
+	for _, se := range sortedEntries(cur) {
+		oldSe, ok := old[se.Path]
+		if ok && oldSe.IsDir == se.IsDir && (oldSe.Inode == se.Inode || se.Inode == 0) {
+			if !se.IsDir && (oldSe.Size != se.Size || !oldSe.ModTime.Equal(se.ModTime)) {
+				modified = append(modified, se)
+			}
+
+			continue
+		}
+
+		if oldSe, ok := oldByInode[se.Inode]; ok && se.Inode != 0 && oldSe.IsDir == se.IsDir {
+			if curSe, ok := cur[oldSe.Path]; !ok || curSe.Inode != oldSe.Inode {
+				renamedFrom[oldSe.Path] = se.Path
+
+				if !se.IsDir && (oldSe.Size != se.Size || !oldSe.ModTime.Equal(se.ModTime)) {
+					modified = append(modified, se)
+				}
+
+				continue
+			}
+		}
+
+		created = append(created, se)
+	}
+
+	var deleted []snapshotEntry
+	for _, se := range sortedEntries(old) {
+		if _, ok := renamedFrom[se.Path]; ok {
+			continue
+		}
+
+		if curSe, ok := cur[se.Path]; !ok || curSe.IsDir != se.IsDir || (curSe.Inode != se.Inode && se.Inode != 0 && curSe.Inode != 0) {
+			deleted = append(deleted, se)
+		}
+	}
+
+	var events []Event
+	deletedDirs := dirsSet(deleted)
+	createdDirs := dirsSet(created)
+
+	for _, se := range deleted {
+		if hasAncestorIn(se.Path, deletedDirs) {
+			continue
+		}
+
+		events = append(events, DeleteEvent{
+			eventMeta: newMeta(),
+			path:      se.Path,
+			isDir:     se.IsDir,
+		})
+	}
+
+	renamedOldPaths := make([]string, 0, len(renamedFrom))
+	for oldPath := range renamedFrom {
+		renamedOldPaths = append(renamedOldPaths, oldPath)
+	}
+	sort.Slice(renamedOldPaths, func(i, j int) bool {
+		return renamedFrom[renamedOldPaths[i]] < renamedFrom[renamedOldPaths[j]]
+	})
+
+	for _, oldPath := range renamedOldPaths {
+		newPath := renamedFrom[oldPath]
+
+		if isInsideRenamedDir(oldPath, newPath, renamedFrom) {
+			continue
+		}
+
+		events = append(events, RenameEvent{
+			eventMeta: newMeta(),
+			OldPath:   oldPath,
+			path:      newPath,
+			isDir:     cur[newPath].IsDir,
+		})
+	}
+
+	for _, se := range created {
+		if hasAncestorIn(se.Path, createdDirs) {
+			continue
+		}
+
+		events = append(events, CreateEvent{
+			eventMeta: newMeta(),
+			path:      se.Path,
+			isDir:     se.IsDir,
+		})
+	}
+
+	for _, se := range modified {
+		if hasAncestorIn(se.Path, createdDirs) {
+			continue
+		}
+
+		events = append(events, ModifyEvent{
+			eventMeta: newMeta(),
+			path:      se.Path,
+		})
+	}
+
+	return events
+}
+
+// dirsSet returns the set of paths of the directories in entries.
+func dirsSet(entries []snapshotEntry) map[string]bool {
+	dirs := map[string]bool{}
+	for _, se := range entries {
+		if se.IsDir {
+			dirs[se.Path] = true
+		}
+	}
+
+	return dirs
+}
+
+// hasAncestorIn returns whether any of dirs is an ancestor of p.
+func hasAncestorIn(p string, dirs map[string]bool) bool {
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isInsideRenamedDir returns whether the rename of oldPath to newPath is
+// a consequence of the rename of one of its ancestors.
+func isInsideRenamedDir(oldPath, newPath string, renamedFrom map[string]string) bool {
+	for dir := path.Dir(oldPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		newDir, ok := renamedFrom[dir]
+		if !ok {
+			continue
+		}
+
+		if strings.TrimPrefix(oldPath, dir) == strings.TrimPrefix(newPath, newDir) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedEntries(s snapshot) []snapshotEntry {
+	entries := make([]snapshotEntry, 0, len(s))
+	for _, se := range s {
+		entries = append(entries, se)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	return entries
+}
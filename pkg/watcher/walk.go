@@ -0,0 +1,59 @@
+package watcher
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+)
+
+// dirVisitor is called by walkDirs for every entry found.
+type dirVisitor interface {
+	// dir is called for a directory that isn't ignored and returns
+	// whether its entries must be walked as well.
+	dir(parentPath, name string) (walk bool, err error)
+	// file is called for a file that isn't ignored.
+	file(parentPath, name string)
+	// ignored is called for a file or directory that is a match for rx.
+	ignored(parentPath, name string, isDir bool, rx *regexp.Regexp)
+}
+
+// walkDirs walks the entries of the directory at dirPath recursively,
+// calling v for each of them. The entries of the directories that are
+// a match for any of ignoreRegExps aren't walked.
+func walkDirs(dirPath string, ignoreRegExps []*regexp.Regexp, v dirVisitor) error {
+	entries, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return fmt.Errorf("reading %v dir: %v", dirPath, err)
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.Name())
+
+		if rx := matchingRegExp(ignoreRegExps, entryPath, entry.IsDir()); rx != nil {
+			v.ignored(dirPath, entry.Name(), entry.IsDir(), rx)
+
+			continue
+		}
+
+		if !entry.IsDir() {
+			v.file(dirPath, entry.Name())
+
+			continue
+		}
+
+		walk, err := v.dir(dirPath, entry.Name())
+		if err != nil {
+			return err
+		}
+		if !walk {
+			continue
+		}
+
+		if err := walkDirs(entryPath, ignoreRegExps, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -4,11 +4,13 @@ Package watcher provides an inotify-based approach for watching file system even
 package watcher
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"path"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/unix"
@@ -17,32 +19,123 @@ import (
 const eventsBufferSize = (unix.SizeofInotifyEvent + 1 + unix.NAME_MAX) * 64
 const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
 
+// inotifyAddWatch is a variable so that tests can make adding a watch fail.
+var inotifyAddWatch = unix.InotifyAddWatch
+
 // W is a watcher for a directory.
 type W struct {
 	fd            int
-	closed        bool
+	closeOnce     sync.Once
 	tree          *watchedDirsTree
 	ignoreRegExps []*regexp.Regexp
 	done          chan struct{}
 	events        chan Event
 	errs          chan error
 	mvEvents      *mvEvents
+	// seq is the sequence number of the last emitted event.
+	seq uint64
+	// hashes is nil if unchanged writes aren't skipped.
+	hashes *hashCache
+	// rootPath is the path of the watched directory.
+	rootPath     string
+	snapshotPath string
+	// pending are the events to be emitted before any event
+	// read from the inotify instance.
+	pending []Event
+	// nPending is the initial length of pending.
+	nPending             int
+	renameWindow         time.Duration
+	splitUnpairedRenames bool
+	// polled is nil if there's no fallback to polling.
+	polled        *polledDirs
+	pollInterval  time.Duration
+	polledChanges chan polledChange
+}
+
+// Options are the optional settings of a watcher.
+// The zero value is a valid set of options.
+type Options struct {
+	// SkipUnchangedWrites is whether to suppress ModifyEvents about files
+	// whose content is the same as when the watcher last saw them, including
+	// the ones detected in polled directories.
+	SkipUnchangedWrites bool
+	// HashSizeLimit is the size in bytes above which files are compared by
+	// size and modification time instead of by the hash of their content
+	// when SkipUnchangedWrites is true. Defaults to 4 MiB if <= 0.
+	HashSizeLimit int64
+	// SnapshotPath, if not empty, is the path of the file where the state of the
+	// watched directory is stored when the watcher is closed. When the watcher is
+	// created, the stored state is compared to the current one and the events
+	// needed to go from the former to the latter are emitted before any other.
+	SnapshotPath string
+	// RenameWindow is the amount of time to wait for the IN_MOVED_TO event that
+	// pairs with an IN_MOVED_FROM event before considering that the item was
+	// moved out of the watched directory. Defaults to 100ms if <= 0.
+	RenameWindow time.Duration
+	// SplitUnpairedRenames is whether an item moved out of the watched directory
+	// is reported as a DeleteEvent and an item moved into it as a CreateEvent,
+	// instead of as a RenameEvent with an empty path or old path.
+	SplitUnpairedRenames bool
+	// PollFallback is whether to poll the directories that can't be watched
+	// because fs.inotify.max_user_watches has been reached, instead of failing
+	// with a *WatchLimitError. Note that the watched directory itself must
+	// always be watchable.
+	PollFallback bool
+	// PollInterval is the interval between two polls when PollFallback is true.
+	// Defaults to 1s if <= 0.
+	PollInterval time.Duration
 }
 
 // New creates a watcher for dirPath recursively, ignoring any path that matches at least one of ignoreRegExps.
 // Directory paths matched against ignoreRegExps end with a /.
 func New(dirPath string, ignoreRegExps []*regexp.Regexp) (*W, error) {
+	return NewWithOptions(dirPath, ignoreRegExps, Options{})
+}
+
+// NewWithOptions is the same as New, except that it accepts options.
+func NewWithOptions(dirPath string, ignoreRegExps []*regexp.Regexp, opts Options) (*W, error) {
 	fd, err := unix.InotifyInit1(0)
 	if err != nil {
+		if isLimitErr(err) {
+			limits, _ := InotifyLimits()
+
+			return nil, &WatchLimitError{
+				Err:    err,
+				Limits: limits,
+				Needed: -1,
+			}
+		}
+
 		return nil, fmt.Errorf("creating inotify instance: %v", err)
 	}
 
 	done := make(chan struct{})
 	w := &W{
-		fd:            fd,
-		tree:          newWatchedDirsTree(),
-		done:          done,
-		ignoreRegExps: ignoreRegExps,
+		fd:                   fd,
+		tree:                 newWatchedDirsTree(),
+		done:                 done,
+		ignoreRegExps:        ignoreRegExps,
+		rootPath:             dirPath,
+		snapshotPath:         opts.SnapshotPath,
+		renameWindow:         opts.RenameWindow,
+		splitUnpairedRenames: opts.SplitUnpairedRenames,
+	}
+
+	if opts.SkipUnchangedWrites {
+		w.hashes = newHashCache(opts.HashSizeLimit)
+	}
+
+	if opts.PollFallback {
+		w.polled = &polledDirs{
+			items: map[string]snapshot{},
+		}
+
+		w.pollInterval = opts.PollInterval
+		if w.pollInterval <= 0 {
+			w.pollInterval = defaultPollInterval
+		}
+
+		w.polledChanges = make(chan polledChange)
 	}
 
 	rootWd, err := w.addToInotify(dirPath)
@@ -56,12 +149,36 @@ func New(dirPath string, ignoreRegExps []*regexp.Regexp) (*W, error) {
 		return nil, err
 	}
 
+	if w.snapshotPath != "" {
+		oldSnapshot, err := readSnapshot(w.snapshotPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot: %v", err)
+		}
+
+		if oldSnapshot != nil {
+			curSnapshot, err := w.takeSnapshot(dirPath, w.snapshotPath)
+			if err != nil {
+				return nil, fmt.Errorf("taking snapshot: %v", err)
+			}
+
+			now := time.Now()
+			w.pending = diffSnapshots(oldSnapshot, curSnapshot, func() eventMeta {
+				return w.newEventMeta(now)
+			})
+			w.nPending = len(w.pending)
+		}
+	}
+
 	w.events = make(chan Event)
 	w.errs = make(chan error)
-	w.mvEvents = newMvEvents()
+	w.mvEvents = newMvEvents(w.renameWindow)
 
 	w.startReading()
 
+	if w.polled != nil {
+		w.startPolling()
+	}
+
 	return w, nil
 }
 
@@ -70,6 +187,7 @@ func (w *W) startReading() {
 	readingRes := make(chan struct {
 		inotifyE unix.InotifyEvent
 		name     string
+		time     time.Time
 	})
 
 	// reading from inotify instance's fd
@@ -88,6 +206,7 @@ func (w *W) startReading() {
 				readingErr <- err
 				return
 			}
+			readAt := time.Now()
 
 			previousNameLen := 0
 			for i := 0; i < n; i += int(unix.SizeofInotifyEvent + previousNameLen) {
@@ -110,9 +229,11 @@ func (w *W) startReading() {
 				readingRes <- struct {
 					inotifyE unix.InotifyEvent
 					name     string
+					time     time.Time
 				}{
 					*inotifyE,
 					name,
+					readAt,
 				}
 
 				previousNameLen = int(inotifyE.Len)
@@ -124,6 +245,15 @@ func (w *W) startReading() {
 		defer w.mvEvents.close()
 		defer w.Close()
 
+		for _, e := range w.pending {
+			select {
+			case <-w.done:
+				return
+			case w.events <- e:
+			}
+		}
+		w.pending = nil
+
 		for {
 			select {
 			case <-w.done:
@@ -160,52 +290,55 @@ func (w *W) startReading() {
 					return
 				case res.inotifyE.Mask&unix.IN_CREATE == unix.IN_CREATE:
 					if isDir {
-						_, match, err := w.addDir(res.name, parentDir.wd)
-						if !match {
-							if err != nil {
-								w.errs <- err
-
-								return
-							}
-
-							err = w.addDirsStartingAt(fileOrDirPath)
-							if err != nil {
-								w.errs <- err
+						if err := w.addDirRecursively(res.name, parentDir.wd); err != nil {
+							w.errs <- err
 
-								return
-							}
+							return
 						}
 					}
 
 					e = CreateEvent{
-						path:  fileOrDirPath,
-						isDir: isDir,
+						eventMeta: w.newEventMeta(res.time),
+						path:      fileOrDirPath,
+						isDir:     isDir,
 					}
 				case res.inotifyE.Mask&unix.IN_DELETE == unix.IN_DELETE:
 					if isDir {
 						dir := w.tree.find(fileOrDirPath)
-						// this should never happen
-						if dir == nil {
+						// this should never happen, unless the directory was being polled
+						if dir == nil && !w.unpoll(fileOrDirPath) {
 							continue
 						}
 
 						// the directory isn't removed from the inotify instance
 						// because it was removed automatically when it was removed
-						w.tree.rm(dir.wd)
+						if dir != nil {
+							w.tree.rm(dir.wd)
+						}
+					}
+
+					if w.hashes != nil {
+						w.hashes.rm(fileOrDirPath)
 					}
 
 					e = DeleteEvent{
-						path:  fileOrDirPath,
-						isDir: isDir,
+						eventMeta: w.newEventMeta(res.time),
+						path:      fileOrDirPath,
+						isDir:     isDir,
 					}
 				case res.inotifyE.Mask&unix.IN_CLOSE_WRITE == unix.IN_CLOSE_WRITE:
+					if w.hashes != nil && !w.hashes.update(fileOrDirPath) {
+						continue
+					}
+
 					e = ModifyEvent{
-						path: fileOrDirPath,
+						eventMeta: w.newEventMeta(res.time),
+						path:      fileOrDirPath,
 					}
 				case res.inotifyE.Mask&unix.IN_MOVED_FROM == unix.IN_MOVED_FROM:
-					w.mvEvents.addMvFrom(int(res.inotifyE.Cookie), res.name, int(res.inotifyE.Wd), isDir)
+					w.mvEvents.addMvFrom(int(res.inotifyE.Cookie), res.name, int(res.inotifyE.Wd), isDir, res.time)
 				case res.inotifyE.Mask&unix.IN_MOVED_TO == unix.IN_MOVED_TO:
-					w.mvEvents.addMvTo(int(res.inotifyE.Cookie), res.name, int(res.inotifyE.Wd), isDir)
+					w.mvEvents.addMvTo(int(res.inotifyE.Cookie), res.name, int(res.inotifyE.Wd), isDir, res.time)
 				}
 
 				if e != nil {
@@ -229,7 +362,19 @@ func (w *W) startReading() {
 					)
 
 					if mvEvent.isDir {
-						w.tree.mv(w.tree.find(oldPath).wd, mvEvent.newParentWd, mvEvent.newName)
+						if w.hashes != nil {
+							w.hashes.rm(newPath)
+						}
+
+						if dir := w.tree.find(oldPath); dir != nil {
+							w.tree.mv(dir.wd, mvEvent.newParentWd, mvEvent.newName)
+						} else if w.unpoll(oldPath) {
+							if err := w.addDirRecursively(mvEvent.newName, mvEvent.newParentWd); err != nil {
+								w.errs <- err
+
+								return
+							}
+						}
 					}
 				case hasMvFrom:
 					oldPath = path.Join(
@@ -238,7 +383,11 @@ func (w *W) startReading() {
 					)
 
 					if mvEvent.isDir {
-						w.tree.rm(w.tree.find(oldPath).wd)
+						if dir := w.tree.find(oldPath); dir != nil {
+							w.tree.rm(dir.wd)
+						} else {
+							w.unpoll(oldPath)
+						}
 					}
 				case hasMvTo:
 					newPath = path.Join(
@@ -247,28 +396,61 @@ func (w *W) startReading() {
 					)
 
 					if mvEvent.isDir {
-						_, match, err := w.addDir(mvEvent.newName, mvEvent.newParentWd)
-						if !match {
-							if err != nil {
-								w.errs <- err
+						if w.hashes != nil {
+							w.hashes.rm(newPath)
+						}
 
-								return
-							}
+						if err := w.addDirRecursively(mvEvent.newName, mvEvent.newParentWd); err != nil {
+							w.errs <- err
 
-							err = w.addDirsStartingAt(newPath)
-							if err != nil {
-								w.errs <- err
-
-								return
-							}
+							return
 						}
 					}
 				}
 
-				w.events <- RenameEvent{
-					isDir:   mvEvent.isDir,
-					OldPath: oldPath,
-					path:    newPath,
+				if w.hashes != nil && oldPath != "" {
+					w.hashes.rm(oldPath)
+				}
+
+				// the file at newPath, if any, has been replaced
+				if w.hashes != nil && newPath != "" && !mvEvent.isDir {
+					w.hashes.update(newPath)
+				}
+
+				switch {
+				case w.splitUnpairedRenames && !hasMvTo:
+					w.events <- DeleteEvent{
+						eventMeta: w.newEventMeta(mvEvent.time),
+						path:      oldPath,
+						isDir:     mvEvent.isDir,
+					}
+				case w.splitUnpairedRenames && !hasMvFrom:
+					w.events <- CreateEvent{
+						eventMeta: w.newEventMeta(mvEvent.time),
+						path:      newPath,
+						isDir:     mvEvent.isDir,
+					}
+				default:
+					w.events <- RenameEvent{
+						eventMeta: w.newEventMeta(mvEvent.time),
+						isDir:     mvEvent.isDir,
+						OldPath:   oldPath,
+						path:      newPath,
+						cookie:    uint32(mvEvent.cookie),
+					}
+				}
+			case pc := <-w.polledChanges:
+				now := time.Now()
+				events := diffSnapshots(pc.old, pc.cur, func() eventMeta {
+					return w.newEventMeta(now)
+				})
+
+				for _, e := range events {
+					if w.hashes != nil && !w.hashes.updateFromEvent(e) {
+						continue
+					}
+
+					w.events <- e
 				}
 			}
 		}
@@ -290,69 +472,139 @@ func (w *W) Wait() {
 	<-w.done
 }
 
+// Pending returns the number of events about the changes made while the
+// watcher wasn't running, which are the first ones sent to the events channel.
+// It's always 0 if the watcher wasn't created with a SnapshotPath.
+func (w *W) Pending() int {
+	return w.nPending
+}
+
 // Close closes the watcher.
+// If the watcher was created with a SnapshotPath, the state of the watched
+// directory is stored before closing it.
 // If the watcher is already closed, it's a no-op.
 func (w *W) Close() error {
-	if w.closed {
-		return nil
+	var err error
+	w.closeOnce.Do(func() {
+		err = w.close()
+	})
+
+	return err
+}
+
+func (w *W) close() error {
+	var snapshotErr error
+	if w.snapshotPath != "" {
+		snapshotErr = w.saveSnapshot()
 	}
 
-	w.closed = true
 	err := unix.Close(w.fd)
 	close(w.done)
 	if err != nil {
 		return fmt.Errorf("closing fd: %v", err)
 	}
 
+	return snapshotErr
+}
+
+// saveSnapshot stores the current state of the watched directory at w.snapshotPath.
+func (w *W) saveSnapshot() error {
+	s, err := w.takeSnapshot(w.rootPath, w.snapshotPath)
+	if err != nil {
+		return fmt.Errorf("taking snapshot: %v", err)
+	}
+
+	if err := writeSnapshot(w.snapshotPath, s); err != nil {
+		return fmt.Errorf("writing snapshot: %v", err)
+	}
+
 	return nil
 }
 
+// newEventMeta returns the metadata for the next event to be emitted,
+// which was read from the inotify instance's fd at t.
+func (w *W) newEventMeta(t time.Time) eventMeta {
+	w.seq++
+
+	return eventMeta{
+		time: t,
+		seq:  w.seq,
+	}
+}
+
 // addDirsStartingAt adds every directory descendant of rootPath recursively
-// to the tree and to the inotify instance.
+// to the tree and to the inotify instance. If unchanged writes are skipped,
+// it also stores the fingerprint of every file found.
 // This functions assumes that there's a node in the tree whose path is equal
 // to cleanPath(rootPath).
 func (w *W) addDirsStartingAt(rootPath string) error {
-	entries, err := ioutil.ReadDir(rootPath)
+	return walkDirs(rootPath, w.ignoreRegExps, watcherVisitor{w})
+}
+
+// watcherVisitor adds the directories walked to a watcher.
+type watcherVisitor struct {
+	w *W
+}
+
+func (v watcherVisitor) dir(parentPath, name string) (bool, error) {
+	_, skip, err := v.w.watchDir(name, v.w.tree.find(cleanPath(parentPath)).wd)
 	if err != nil {
-		return fmt.Errorf("reading %v dir: %v", rootPath, err)
+		return false, err
 	}
 
-	for _, entry := range entries {
-		if entry.IsDir() {
-			dirPath := path.Join(rootPath, entry.Name())
+	return !skip, nil
+}
 
-			_, match, err := w.addDir(
-				entry.Name(),
-				w.tree.find(cleanPath(rootPath)).wd,
-			)
-			if match {
-				continue
-			}
-			if err != nil {
-				return err
-			}
+func (v watcherVisitor) file(parentPath, name string) {
+	if v.w.hashes != nil {
+		v.w.hashes.update(path.Join(parentPath, name))
+	}
+}
 
-			err = w.addDirsStartingAt(dirPath)
-			if err != nil {
-				return err
-			}
-		}
+func (v watcherVisitor) ignored(parentPath, name string, isDir bool, rx *regexp.Regexp) {}
+
+// addDirRecursively adds a directory and its descendants to the tree and to the
+// inotify instance, unless it's a match for any of w.ignoreRegExps.
+func (w *W) addDirRecursively(name string, parentWd int) error {
+	_, skip, err := w.addDir(name, parentWd)
+	if skip {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return w.addDirsStartingAt(path.Join(w.tree.path(parentWd), name))
 }
 
 // addDir checks if a directory isn't a match for any of w.ignoreRegExps and, if it isn't,
 // adds it to the tree and to the inotify instance and returns the added directory's wd.
-func (w *W) addDir(name string, parentWd int) (wd int, match bool, err error) {
-	dirPath := path.Join(w.tree.path(parentWd), name)
-
-	if w.matchPath(dirPath, true) {
+// skip is true if the directory is a match or if it's polled because an inotify limit
+// has been reached, in which case its descendants mustn't be added either.
+func (w *W) addDir(name string, parentWd int) (wd int, skip bool, err error) {
+	if w.matchPath(path.Join(w.tree.path(parentWd), name), true) {
 		return -1, true, nil
 	}
 
+	return w.watchDir(name, parentWd)
+}
+
+// watchDir is like addDir, except that it doesn't check
+// whether the directory is a match for any of w.ignoreRegExps.
+func (w *W) watchDir(name string, parentWd int) (wd int, skip bool, err error) {
+	dirPath := path.Join(w.tree.path(parentWd), name)
+
 	wd, err = w.addToInotify(dirPath)
 	if err != nil {
+		var limitErr *WatchLimitError
+		if w.polled != nil && errors.As(err, &limitErr) && limitErr.Err == unix.ENOSPC {
+			if err := w.poll(dirPath); err != nil {
+				return -1, false, fmt.Errorf("polling %v: %v", dirPath, err)
+			}
+
+			return -1, true, nil
+		}
+
 		return -1, false, err
 	}
 
@@ -366,8 +618,27 @@ func (w *W) addDir(name string, parentWd int) (wd int, match bool, err error) {
 // Note that it doesn't check whether the given path is match for any of
 // w.ignoreRegExps.
 func (w *W) addToInotify(path string) (int, error) {
-	wd, err := unix.InotifyAddWatch(w.fd, path, inotifyMask)
+	wd, err := inotifyAddWatch(w.fd, path, inotifyMask)
 	if err != nil {
+		if isLimitErr(err) {
+			limitErr := &WatchLimitError{
+				Path:   path,
+				Err:    err,
+				Needed: -1,
+			}
+			limitErr.Limits, _ = InotifyLimits()
+
+			// when falling back to polling, the error isn't returned,
+			// so there's no need to count the directories.
+			if w.polled == nil {
+				if needed, err := CountDirs(w.rootPath, w.ignoreRegExps); err == nil {
+					limitErr.Needed = needed
+				}
+			}
+
+			return -1, limitErr
+		}
+
 		return -1, fmt.Errorf("adding directory to inotify instance: %v", err)
 	}
 
@@ -386,15 +657,52 @@ func (w *W) removeFromInotify(wd int) error {
 
 // matchPath returns whether the given path matchs any of w.ignoreRegExps.
 func (w *W) matchPath(path string, isDir bool) bool {
+	return matchingRegExp(w.ignoreRegExps, path, isDir) != nil
+}
+
+// matchingRegExp returns the first of ignoreRegExps that matches the given path.
+// Directories are matched with a trailing slash.
+func matchingRegExp(ignoreRegExps []*regexp.Regexp, path string, isDir bool) *regexp.Regexp {
 	if isDir {
 		path += "/"
 	}
 
-	for _, rx := range w.ignoreRegExps {
+	for _, rx := range ignoreRegExps {
 		if match := rx.MatchString(path); match {
-			return true
+			return rx
 		}
 	}
 
-	return false
+	return nil
+}
+
+// IgnoredBy returns the regexp that causes p, a path relative to the watched
+// directory, to be ignored by a watcher created with ignoreRegExps, along with
+// the path that it matched. Since ignored directories aren't watched, the matched
+// path can also be one of p's parent directories, in which case it has a trailing
+// slash. If p isn't ignored, rx is nil.
+func IgnoredBy(p string, isDir bool, ignoreRegExps []*regexp.Regexp) (rx *regexp.Regexp, matchedPath string) {
+	p = cleanPath(p)
+	if p == "" {
+		return nil, ""
+	}
+
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		dirPath := strings.Join(parts[:i], "/")
+
+		if rx := matchingRegExp(ignoreRegExps, dirPath, true); rx != nil {
+			return rx, dirPath + "/"
+		}
+	}
+
+	if rx := matchingRegExp(ignoreRegExps, p, isDir); rx != nil {
+		if isDir {
+			return rx, p + "/"
+		}
+
+		return rx, p
+	}
+
+	return nil, ""
 }
@@ -4,14 +4,46 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"regexp"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // eventTimeout represents the amount of time to wait for an event.
 var eventTimeout = time.Millisecond * 150
 
+// sameEvent returns whether a and b are equal, disregarding their metadata.
+func sameEvent(a, b Event) bool {
+	return withoutMeta(a) == withoutMeta(b)
+}
+
+func withoutMeta(e Event) Event {
+	switch e := e.(type) {
+	case CreateEvent:
+		e.eventMeta = eventMeta{}
+
+		return e
+	case DeleteEvent:
+		e.eventMeta = eventMeta{}
+
+		return e
+	case ModifyEvent:
+		e.eventMeta = eventMeta{}
+
+		return e
+	case RenameEvent:
+		e.eventMeta = eventMeta{}
+		e.cookie = 0
+
+		return e
+	}
+
+	return e
+}
+
 func TestWatcher_createEvent(t *testing.T) {
 	t.Run("create file", func(t *testing.T) {
 		err := os.MkdirAll("a/b/c/d/e", os.ModeDir|os.ModePerm)
@@ -39,10 +71,11 @@ func TestWatcher_createEvent(t *testing.T) {
 		defer w.Close()
 
 		filePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(filePath)
+		file, err := os.Create(filePath)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
+		defer file.Close()
 
 		expectedEvent := CreateEvent{
 			isDir: false,
@@ -51,7 +84,7 @@ func TestWatcher_createEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -96,7 +129,7 @@ func TestWatcher_createEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -108,10 +141,11 @@ func TestWatcher_createEvent(t *testing.T) {
 		}
 
 		filePath := path.Join(dirPath, "a.txt")
-		_, err = os.Create(filePath)
+		file, err := os.Create(filePath)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
+		defer file.Close()
 
 		expectedEvent = CreateEvent{
 			isDir: false,
@@ -120,7 +154,7 @@ func TestWatcher_createEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -155,10 +189,11 @@ func TestWatcher_createEvent(t *testing.T) {
 		defer w.Close()
 
 		filePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(filePath)
+		file, err := os.Create(filePath)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
+		defer file.Close()
 
 		select {
 		case e := <-w.Events():
@@ -210,10 +245,11 @@ func TestWatcher_createEvent(t *testing.T) {
 		}
 
 		filePath := path.Join(dirPath, "a.txt")
-		_, err = os.Create(filePath)
+		file, err := os.Create(filePath)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
+		defer file.Close()
 
 		select {
 		case e := <-w.Events():
@@ -242,7 +278,7 @@ func TestWatcher_deleteEvent(t *testing.T) {
 		defer os.RemoveAll("f")
 
 		filePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(filePath)
+		err = ioutil.WriteFile(filePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
@@ -266,7 +302,7 @@ func TestWatcher_deleteEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -321,7 +357,7 @@ func TestWatcher_deleteEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -347,7 +383,7 @@ func TestWatcher_deleteEvent(t *testing.T) {
 		defer os.RemoveAll("f")
 
 		filePath := path.Join("f/g/h/i/j", "foo")
-		_, err = os.Create(filePath)
+		err = ioutil.WriteFile(filePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
@@ -391,7 +427,7 @@ func TestWatcher_deleteEvent(t *testing.T) {
 		defer os.RemoveAll("f")
 
 		dirPath := path.Join("f/g/h/i/j", "foo")
-		_, err = os.Create(dirPath)
+		err = ioutil.WriteFile(dirPath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", dirPath, err)
 		}
@@ -437,7 +473,7 @@ func TestWatcher_modifyEvent(t *testing.T) {
 		defer os.RemoveAll("f")
 
 		filePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(filePath)
+		err = ioutil.WriteFile(filePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
@@ -465,7 +501,7 @@ func TestWatcher_modifyEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -491,7 +527,7 @@ func TestWatcher_modifyEvent(t *testing.T) {
 		defer os.RemoveAll("f")
 
 		filePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(filePath)
+		err = ioutil.WriteFile(filePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
@@ -523,7 +559,7 @@ func TestWatcher_modifyEvent(t *testing.T) {
 
 	t.Run("modify file (regexp) (2)", func(t *testing.T) {
 		filePath := "foobar"
-		_, err := os.Create(filePath)
+		err := ioutil.WriteFile(filePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", filePath, err)
 		}
@@ -536,7 +572,7 @@ func TestWatcher_modifyEvent(t *testing.T) {
 		defer os.RemoveAll("a")
 
 		file2Path := path.Join("a", "foobar", "b.txt")
-		_, err = os.Create(file2Path)
+		err = ioutil.WriteFile(file2Path, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", file2Path, err)
 		}
@@ -566,7 +602,7 @@ func TestWatcher_modifyEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -595,7 +631,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		oldFilePath := path.Join("a/b/c/d/e", "a.txt")
 		newFilePath := path.Join("f/g/h/i/j", "b.txt")
-		_, err = os.Create(oldFilePath)
+		err = ioutil.WriteFile(oldFilePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", oldFilePath, err)
 		}
@@ -620,7 +656,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -647,7 +683,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		oldFilePath := path.Join("a/b/c/d/e", "a.txt")
 		newFilePath := path.Join("f/g/h/i/j", "b.txt")
-		_, err = os.Create(oldFilePath)
+		err = ioutil.WriteFile(oldFilePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", oldFilePath, err)
 		}
@@ -674,7 +710,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -701,7 +737,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		oldFilePath := path.Join("f/g/h/i/j", "b.txt")
 		newFilePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(oldFilePath)
+		err = ioutil.WriteFile(oldFilePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", oldFilePath, err)
 		}
@@ -733,7 +769,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		select {
 		case e := <-w.Events():
-			if e != expectedEvent {
+			if !sameEvent(e, expectedEvent) {
 				t.Fatalf("got %v, want %v", e, expectedEvent)
 			}
 		case err := <-w.Errs():
@@ -760,7 +796,7 @@ func TestWatcher_renameEvent(t *testing.T) {
 
 		oldFilePath := path.Join("f/g/h/i/j", "b.txt")
 		newFilePath := path.Join("a/b/c/d/e", "a.txt")
-		_, err = os.Create(oldFilePath)
+		err = ioutil.WriteFile(oldFilePath, nil, os.ModePerm)
 		if err != nil {
 			t.Fatalf("unexpected error creating %v: %v", oldFilePath, err)
 		}
@@ -791,3 +827,713 @@ func TestWatcher_renameEvent(t *testing.T) {
 		}
 	})
 }
+
+func TestWatcher_eventMeta(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	w, err := New(".", []*regexp.Regexp{})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer w.Close()
+
+	start := time.Now()
+
+	filePath := path.Join("a/b", "a.txt")
+	err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+	}
+
+	newFilePath := path.Join("a", "b.txt")
+	err = os.Rename(filePath, newFilePath)
+	if err != nil {
+		t.Fatalf("unexpected error renaming %v to %v: %v", filePath, newFilePath, err)
+	}
+
+	expectedOps := []Op{CreateOp, ModifyOp, RenameOp}
+	var lastSeq uint64
+
+	for _, expectedOp := range expectedOps {
+		select {
+		case e := <-w.Events():
+			if e.Op() != expectedOp {
+				t.Fatalf("got %v, want %v", e.Op(), expectedOp)
+			}
+
+			if e.Seq() != lastSeq+1 {
+				t.Errorf("got %v, want %v", e.Seq(), lastSeq+1)
+			}
+			lastSeq = e.Seq()
+
+			if e.Time().Before(start) || e.Time().After(time.Now()) {
+				t.Errorf("unexpected time %v", e.Time())
+			}
+
+			if re, ok := e.(RenameEvent); ok && re.Cookie() == 0 {
+				t.Error("got 0, want non-zero cookie")
+			}
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+			t.Fatal("timeout reached waiting for event")
+		}
+	}
+}
+
+func TestWatcher_skipUnchangedWrites(t *testing.T) {
+	t.Run("same content", func(t *testing.T) {
+		err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+		}
+		defer os.RemoveAll("a")
+
+		filePath := path.Join("a/b", "a.txt")
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		w, err := NewWithOptions(".", []*regexp.Regexp{}, Options{
+			SkipUnchangedWrites: true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer w.Close()
+
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		select {
+		case e := <-w.Events():
+			t.Fatalf("unexpected event %v", e)
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+		}
+
+		err = ioutil.WriteFile(filePath, []byte("bar"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		expectedEvent := ModifyEvent{
+			path: filePath,
+		}
+
+		select {
+		case e := <-w.Events():
+			if !sameEvent(e, expectedEvent) {
+				t.Fatalf("got %v, want %v", e, expectedEvent)
+			}
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+			t.Fatal("timeout reached waiting for event")
+		}
+	})
+
+	t.Run("rename over a file, then rewrite it", func(t *testing.T) {
+		err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+		}
+		defer os.RemoveAll("a")
+
+		filePath := path.Join("a/b", "a.txt")
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		w, err := NewWithOptions(".", []*regexp.Regexp{}, Options{
+			SkipUnchangedWrites: true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer w.Close()
+
+		tmpFilePath := path.Join("a/b", "a.txt.tmp")
+		err = ioutil.WriteFile(tmpFilePath, []byte("bar"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", tmpFilePath, err)
+		}
+
+		err = os.Rename(tmpFilePath, filePath)
+		if err != nil {
+			t.Fatalf("unexpected error renaming %v to %v: %v", tmpFilePath, filePath, err)
+		}
+
+	renameLoop:
+		for {
+			select {
+			case e := <-w.Events():
+				if _, ok := e.(RenameEvent); ok {
+					break renameLoop
+				}
+			case err := <-w.Errs():
+				t.Fatalf("unexpected err: %v", err)
+			case <-w.done:
+				t.Fatal("channel closed")
+			case <-time.After(eventTimeout):
+				t.Fatal("timeout reached waiting for event")
+			}
+		}
+
+		// the content is back to the one before the rename
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		expectedEvent := ModifyEvent{
+			path: filePath,
+		}
+
+		select {
+		case e := <-w.Events():
+			if !sameEvent(e, expectedEvent) {
+				t.Fatalf("got %v, want %v", e, expectedEvent)
+			}
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+			t.Fatal("timeout reached waiting for event")
+		}
+	})
+
+	t.Run("file bigger than hashSizeLimit", func(t *testing.T) {
+		err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+		}
+		defer os.RemoveAll("a")
+
+		filePath := path.Join("a/b", "a.txt")
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		// makes sure the modification time changes when writing again
+		mTime := time.Now().Add(-time.Hour)
+		err = os.Chtimes(filePath, mTime, mTime)
+		if err != nil {
+			t.Fatalf("unexpected error changing times of %v: %v", filePath, err)
+		}
+
+		w, err := NewWithOptions(".", []*regexp.Regexp{}, Options{
+			SkipUnchangedWrites: true,
+			HashSizeLimit:       1,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer w.Close()
+
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+
+		expectedEvent := ModifyEvent{
+			path: filePath,
+		}
+
+		select {
+		case e := <-w.Events():
+			if !sameEvent(e, expectedEvent) {
+				t.Fatalf("got %v, want %v", e, expectedEvent)
+			}
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+			t.Fatal("timeout reached waiting for event")
+		}
+	})
+}
+
+func TestWatcher_snapshot(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	err = os.MkdirAll("f/g", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "f/g", err)
+	}
+	defer os.RemoveAll("f")
+
+	for _, filePath := range []string{"a/b/mod.txt", "a/b/del.txt", "a/b/mv.txt", "f/g/h.txt"} {
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error writing to %v: %v", filePath, err)
+		}
+	}
+
+	snapshotPath := "a/snapshot.json"
+	ignoreRegExps := []*regexp.Regexp{
+		regexp.MustCompile(`\.go$`),
+	}
+
+	w, err := NewWithOptions(".", ignoreRegExps, Options{
+		SnapshotPath: snapshotPath,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	// there's no stored snapshot yet
+	if n := w.Pending(); n != 0 {
+		t.Errorf("got %v pending events, want %v", n, 0)
+	}
+
+	// the snapshot is stored once, even if closed concurrently
+	closeErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			closeErrs <- w.Close()
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := <-closeErrs; err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+	}
+
+	mTime := time.Now().Add(time.Hour)
+	err = os.Chtimes("a/b/mod.txt", mTime, mTime)
+	if err != nil {
+		t.Fatalf("unexpected error changing times of %v: %v", "a/b/mod.txt", err)
+	}
+
+	err = os.Remove("a/b/del.txt")
+	if err != nil {
+		t.Fatalf("unexpected error removing %v: %v", "a/b/del.txt", err)
+	}
+
+	err = os.Rename("a/b/mv.txt", "a/mv.txt")
+	if err != nil {
+		t.Fatalf("unexpected error renaming %v: %v", "a/b/mv.txt", err)
+	}
+
+	err = os.Rename("f/g", "f/z")
+	if err != nil {
+		t.Fatalf("unexpected error renaming %v: %v", "f/g", err)
+	}
+
+	err = os.MkdirAll("a/c/d", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/c/d", err)
+	}
+
+	w, err = NewWithOptions(".", ignoreRegExps, Options{
+		SnapshotPath: snapshotPath,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer w.Close()
+
+	expectedEvents := []Event{
+		DeleteEvent{path: "a/b/del.txt"},
+		RenameEvent{OldPath: "a/b/mv.txt", path: "a/mv.txt"},
+		RenameEvent{OldPath: "f/g", path: "f/z", isDir: true},
+		CreateEvent{path: "a/c", isDir: true},
+		ModifyEvent{path: "a/b/mod.txt"},
+	}
+
+	if n := w.Pending(); n != len(expectedEvents) {
+		t.Errorf("got %v pending events, want %v", n, len(expectedEvents))
+	}
+
+	for _, expectedEvent := range expectedEvents {
+		select {
+		case e := <-w.Events():
+			if !sameEvent(e, expectedEvent) {
+				t.Fatalf("got %v, want %v", e, expectedEvent)
+			}
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+			t.Fatal("timeout reached waiting for event")
+		}
+	}
+
+	select {
+	case e := <-w.Events():
+		t.Fatalf("unexpected event %v", e)
+	case err := <-w.Errs():
+		t.Fatalf("unexpected err: %v", err)
+	case <-w.done:
+		t.Fatal("channel closed")
+	case <-time.After(eventTimeout):
+	}
+}
+
+func TestWatcher_unpairedRenameEvent(t *testing.T) {
+	t.Run("rename directory from an unwatched directory to a watched directory", func(t *testing.T) {
+		err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+		}
+		defer os.RemoveAll("a")
+
+		err = os.MkdirAll("f/g", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "f/g", err)
+		}
+		defer os.RemoveAll("f")
+
+		w, err := New(".", []*regexp.Regexp{
+			regexp.MustCompile("^f.*"),
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer w.Close()
+
+		err = os.Rename("f/g", "a/g")
+		if err != nil {
+			t.Fatalf("unexpected error renaming %v to %v: %v", "f/g", "a/g", err)
+		}
+
+		expectedEvent := RenameEvent{
+			isDir: true,
+			path:  "a/g",
+		}
+
+		select {
+		case e := <-w.Events():
+			if !sameEvent(e, expectedEvent) {
+				t.Fatalf("got %v, want %v", e, expectedEvent)
+			}
+		case err := <-w.Errs():
+			t.Fatalf("unexpected err: %v", err)
+		case <-w.done:
+			t.Fatal("channel closed")
+		case <-time.After(eventTimeout):
+			t.Fatal("timeout reached waiting for event")
+		}
+	})
+
+	t.Run("split", func(t *testing.T) {
+		err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+		}
+		defer os.RemoveAll("a")
+
+		err = os.MkdirAll("f/g", os.ModeDir|os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", "f/g", err)
+		}
+		defer os.RemoveAll("f")
+
+		w, err := NewWithOptions(".", []*regexp.Regexp{
+			regexp.MustCompile("^f.*"),
+		}, Options{
+			SplitUnpairedRenames: true,
+			RenameWindow:         time.Millisecond * 20,
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %v", err)
+		}
+		defer w.Close()
+
+		err = os.Rename("f/g", "a/g")
+		if err != nil {
+			t.Fatalf("unexpected error renaming %v to %v: %v", "f/g", "a/g", err)
+		}
+
+		err = os.Rename("a/b", "f/b")
+		if err != nil {
+			t.Fatalf("unexpected error renaming %v to %v: %v", "a/b", "f/b", err)
+		}
+
+		expectedEvents := []Event{
+			CreateEvent{
+				isDir: true,
+				path:  "a/g",
+			},
+			DeleteEvent{
+				isDir: true,
+				path:  "a/b",
+			},
+		}
+
+		for _, expectedEvent := range expectedEvents {
+			select {
+			case e := <-w.Events():
+				if !sameEvent(e, expectedEvent) {
+					t.Fatalf("got %v, want %v", e, expectedEvent)
+				}
+			case err := <-w.Errs():
+				t.Fatalf("unexpected err: %v", err)
+			case <-w.done:
+				t.Fatal("channel closed")
+			case <-time.After(eventTimeout):
+				t.Fatal("timeout reached waiting for event")
+			}
+		}
+	})
+}
+
+func TestWatcher_pollFallback(t *testing.T) {
+	err := os.MkdirAll("a/b", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b", err)
+	}
+	defer os.RemoveAll("a")
+
+	// a/b can't be watched because the watch limit has been reached
+	defer func(f func(int, string, uint32) (int, error)) {
+		inotifyAddWatch = f
+	}(inotifyAddWatch)
+	inotifyAddWatch = func(fd int, path string, mask uint32) (int, error) {
+		if path == "a/b" {
+			return -1, unix.ENOSPC
+		}
+
+		return unix.InotifyAddWatch(fd, path, mask)
+	}
+
+	pollInterval := 50 * time.Millisecond
+	w, err := NewWithOptions(".", []*regexp.Regexp{}, Options{
+		PollFallback: true,
+		PollInterval: pollInterval,
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+	defer w.Close()
+
+	if polled := w.Polled(); !reflect.DeepEqual(polled, []string{"a/b"}) {
+		t.Fatalf("got %v, want %v", polled, []string{"a/b"})
+	}
+
+	filePath := path.Join("a/b", "a.txt")
+
+	tests := []struct {
+		name          string
+		change        func() error
+		expectedEvent Event
+	}{
+		{
+			"create",
+			func() error { return ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm) },
+			CreateEvent{path: filePath},
+		},
+		{
+			"modify",
+			func() error { return ioutil.WriteFile(filePath, []byte("foobar"), os.ModePerm) },
+			ModifyEvent{path: filePath},
+		},
+		{
+			"delete",
+			func() error { return os.Remove(filePath) },
+			DeleteEvent{path: filePath},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.change(); err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+
+			// the change is detected by the next poll
+
+			select {
+			case e := <-w.Events():
+				if !sameEvent(e, test.expectedEvent) {
+					t.Fatalf("got %v, want %v", e, test.expectedEvent)
+				}
+			case err := <-w.Errs():
+				t.Fatalf("unexpected err: %v", err)
+			case <-w.done:
+				t.Fatal("channel closed")
+			case <-time.After(pollInterval + eventTimeout):
+				t.Fatal("timeout reached waiting for event")
+			}
+		})
+	}
+}
+
+func TestWatchLimitError(t *testing.T) {
+	tests := []struct {
+		err      *WatchLimitError
+		expected string
+	}{
+		{
+			&WatchLimitError{
+				Path:   "a/b",
+				Err:    unix.ENOSPC,
+				Limits: Limits{8192, 128, 16384},
+				Needed: 10000,
+			},
+			"adding a/b to inotify instance: no space left on device (fs.inotify.max_user_watches is 8192 and 10000 directories need to be watched; it can be increased with sysctl)",
+		},
+		{
+			&WatchLimitError{
+				Path:   "a/b",
+				Err:    unix.ENOSPC,
+				Limits: Limits{-1, -1, -1},
+				Needed: -1,
+			},
+			"adding a/b to inotify instance: no space left on device (fs.inotify.max_user_watches is unknown; it can be increased with sysctl)",
+		},
+		{
+			&WatchLimitError{
+				Err:    unix.EMFILE,
+				Limits: Limits{8192, 128, 16384},
+				Needed: -1,
+			},
+			"creating inotify instance: too many open files (fs.inotify.max_user_instances is 128; it can be increased with sysctl)",
+		},
+	}
+
+	for _, test := range tests {
+		if str := test.err.Error(); str != test.expected {
+			t.Errorf("got %v, want %v", str, test.expected)
+		}
+	}
+}
+
+func TestCountDirs(t *testing.T) {
+	err := os.MkdirAll("a/b/c", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b/c", err)
+	}
+	defer os.RemoveAll("a")
+
+	err = os.MkdirAll("a/d", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/d", err)
+	}
+
+	n, err := CountDirs("a", []*regexp.Regexp{
+		regexp.MustCompile("^a/d/$"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	if expectedN := 3; n != expectedN {
+		t.Errorf("got %v, want %v", n, expectedN)
+	}
+}
+
+func TestIgnoredBy(t *testing.T) {
+	rxA := regexp.MustCompile("^a/$")
+	rxGo := regexp.MustCompile("\\.go$")
+	ignoreRegExps := []*regexp.Regexp{rxA, rxGo}
+
+	tests := []struct {
+		p                   string
+		isDir               bool
+		expectedRx          *regexp.Regexp
+		expectedMatchedPath string
+	}{
+		{"a", true, rxA, "a/"},
+		{"a", false, nil, ""},
+		{"a/b/c.txt", false, rxA, "a/"},
+		{"b/c.go", false, rxGo, "b/c.go"},
+		{"./b/c.txt", false, nil, ""},
+		{".", true, nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.p, func(t *testing.T) {
+			rx, matchedPath := IgnoredBy(test.p, test.isDir, ignoreRegExps)
+
+			if rx != test.expectedRx {
+				t.Errorf("got %v, want %v", rx, test.expectedRx)
+			}
+
+			if matchedPath != test.expectedMatchedPath {
+				t.Errorf("got %v, want %v", matchedPath, test.expectedMatchedPath)
+			}
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	err := os.MkdirAll("a/b/c", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/b/c", err)
+	}
+	defer os.RemoveAll("a")
+
+	err = os.MkdirAll("a/d/e", os.ModeDir|os.ModePerm)
+	if err != nil {
+		t.Fatalf("unexpected error creating %v: %v", "a/d/e", err)
+	}
+
+	for _, filePath := range []string{"a/b/f.txt", "a/b/g.go", "a/d/e/h.txt"} {
+		err = ioutil.WriteFile(filePath, []byte("foo"), os.ModePerm)
+		if err != nil {
+			t.Fatalf("unexpected error creating %v: %v", filePath, err)
+		}
+	}
+
+	rxD := regexp.MustCompile("^a/d/$")
+	rxGo := regexp.MustCompile("\\.go$")
+
+	d, err := Scan("a", []*regexp.Regexp{rxD, rxGo})
+	if err != nil {
+		t.Fatalf("unexpected err: %v", err)
+	}
+
+	expectedD := &Dir{
+		Path: "a",
+		Dirs: []*Dir{
+			&Dir{
+				Path: "a/b",
+				Dirs: []*Dir{
+					&Dir{Path: "a/b/c"},
+				},
+				Files: []string{"a/b/f.txt"},
+				Ignored: []IgnoredItem{
+					IgnoredItem{Path: "a/b/g.go", RegExp: rxGo},
+				},
+			},
+		},
+		Ignored: []IgnoredItem{
+			IgnoredItem{Path: "a/d", IsDir: true, RegExp: rxD},
+		},
+	}
+
+	if !reflect.DeepEqual(d, expectedD) {
+		t.Errorf("got %+v, want %+v", d, expectedD)
+	}
+
+	dirs, files, ignored := d.Count()
+	if dirs != 3 || files != 1 || ignored != 2 {
+		t.Errorf("got (%v, %v, %v), want (3, 1, 2)", dirs, files, ignored)
+	}
+}